@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// narrows the configured providers down to the ones named on the command line, or all of them if none were named
+func selectConfiguredProviders(config Configuration, references []string) ([]ProviderMirrorConfiguration, error) {
+	if len(references) == 0 {
+		return config.Providers, nil
+	}
+
+	var selected []ProviderMirrorConfiguration
+	for _, reference := range references {
+		wanted, err := config.NewProvider(reference)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, configProvider := range config.Providers {
+			provider, err := config.NewProvider(configProvider.Reference)
+			if err == nil && provider == wanted {
+				selected = append(selected, configProvider)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("provider %s is not in the config", wanted)
+		}
+	}
+
+	return selected, nil
+}
+
+// like selectConfiguredProviders, but a named provider that is not in the config is looked for in storage, so that
+// providers added with import-zip can be worked on too. With none named, the ones in storage are added to the
+// configured providers if all is set.
+func selectProviders(ctx context.Context, config Configuration, references []string, all bool) ([]ProviderMirrorConfiguration, error) {
+	configured := make(map[Provider]ProviderMirrorConfiguration)
+	for _, configProvider := range config.Providers {
+		provider, err := config.NewProvider(configProvider.Reference)
+		if err == nil {
+			configured[provider] = configProvider
+		}
+	}
+	// storage is only listed when needed, since that can take a while for a large bucket
+	var stored []Provider
+	listed := false
+	listStored := func() error {
+		if listed {
+			return nil
+		}
+		var err error
+		stored, err = ListStoredProviders(ctx, config.DownloadDestination)
+		if err != nil {
+			return fmt.Errorf("error listing the providers in storage: %w", err)
+		}
+		listed = true
+		return nil
+	}
+
+	if len(references) == 0 {
+		selected := slices.Clone(config.Providers)
+		if !all {
+			return selected, nil
+		}
+		err := listStored()
+		if err != nil {
+			return nil, err
+		}
+		for _, provider := range stored {
+			if _, found := configured[provider]; !found {
+				selected = append(selected, storedProviderConfiguration(provider))
+			}
+		}
+		return selected, nil
+	}
+
+	var selected []ProviderMirrorConfiguration
+	for _, reference := range references {
+		wanted, err := config.NewProvider(reference)
+		if err != nil {
+			return nil, err
+		}
+		if configProvider, found := configured[wanted]; found {
+			selected = append(selected, configProvider)
+			continue
+		}
+		err = listStored()
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(stored, wanted) {
+			return nil, fmt.Errorf("provider %s is neither in the config nor in storage", wanted)
+		}
+		selected = append(selected, storedProviderConfiguration(wanted))
+	}
+
+	return selected, nil
+}
+
+// stands in for the config of a provider that is only in storage: every mirrored version and platform counts
+func storedProviderConfiguration(provider Provider) ProviderMirrorConfiguration {
+	return ProviderMirrorConfiguration{
+		Reference:    provider.String(),
+		VersionRange: ">=0.0.0",
+	}
+}
+
+// loads the catalog for a configured provider, for commands that only look at what is already mirrored
+func loadConfiguredProviderCatalog(ctx context.Context, config Configuration, configProvider ProviderMirrorConfiguration) (Provider, ProviderStorer, []ProviderSpecificInstanceBinary, error) {
+	provider, err := config.NewProvider(configProvider.Reference)
+	if err != nil {
+		return provider, nil, nil, fmt.Errorf("error creating provider for %#v: %w", configProvider, err)
+	}
+	storage, err := NewProviderStorer(ctx, config.DownloadDestination, provider, nil)
+	if err != nil {
+		return provider, nil, nil, fmt.Errorf("error setting up storage for provider %s: %w", provider, err)
+	}
+	catalog, err := storage.LoadCatalog()
+	if err != nil {
+		return provider, storage, nil, fmt.Errorf("error loading catalog for provider %s: %w", provider, err)
+	}
+	return provider, storage, catalog, nil
+}
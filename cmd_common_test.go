@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSelectProviders(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{
+		"registry.terraform.io/hashicorp/aws",
+		"registry.example.com/corp/internal",
+		// not a catalog, but a file tfspiegel keeps next to them
+		".quarantine/corp/internal",
+	} {
+		err := os.MkdirAll(filepath.Join(root, dir), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(root, dir, mirrorIndexFile), []byte(`{"versions":{}}`), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := Configuration{
+		Providers: []ProviderMirrorConfiguration{
+			{Reference: "hashicorp/aws", VersionRange: ">=5.0.0"},
+			{Reference: "hashicorp/google", VersionRange: ">=6.0.0"},
+		},
+		DownloadDestination: DownloadDestination{Type: STORAGE_TYPE_FS, FSConfig: fsConfig{DownloadRoot: root}},
+	}
+
+	tests := []struct {
+		name       string
+		references []string
+		all        bool
+		want       []string
+		wantErr    bool
+	}{
+		{"configured only", nil, false, []string{"hashicorp/aws", "hashicorp/google"}, false},
+		{"configured and stored", nil, true, []string{"hashicorp/aws", "hashicorp/google", "registry.example.com/corp/internal"}, false},
+		{"named in the config", []string{"hashicorp/aws"}, false, []string{"hashicorp/aws"}, false},
+		{"named and only in storage", []string{"registry.example.com/corp/internal"}, false, []string{"registry.example.com/corp/internal"}, false},
+		{"named and nowhere", []string{"corp/missing"}, false, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, err := selectProviders(context.Background(), config, tt.references, tt.all)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, configProvider := range selected {
+				got = append(got, configProvider.Reference)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("selected %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("selected %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadStoredProviderCatalog(t *testing.T) {
+	config := Configuration{
+		DownloadDestination: DownloadDestination{Type: STORAGE_TYPE_FS, FSConfig: fsConfig{DownloadRoot: t.TempDir()}},
+	}
+	provider := Provider{Hostname: "registry.example.com", Owner: "corp", Name: "internal"}
+	err := os.MkdirAll(filepath.Join(config.DownloadDestination.FSConfig.DownloadRoot, provider.String()), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage, err := NewProviderStorer(context.Background(), config.DownloadDestination, provider, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storage.StoreCatalog([]ProviderSpecificInstanceBinary{{
+		ProviderSpecificInstance: ProviderSpecificInstance{Provider: provider, Version: "1.0.0-rc1", OS: "linux", Arch: "amd64"},
+		FullPath:                 filepath.Join(config.DownloadDestination.FSConfig.DownloadRoot, provider.String(), "terraform-provider-internal_1.0.0-rc1_linux_amd64.zip"),
+		H1Checksum:               "h1:abc",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every version that is mirrored counts, pre-releases included
+	_, _, catalog, err := loadConfiguredProviderCatalog(context.Background(), config, storedProviderConfiguration(provider))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := renderLockBlock(provider, catalog, storedProviderConfiguration(provider), nil)
+	if err != nil {
+		t.Fatalf("unexpected error locking a provider that is only in storage: %v", err)
+	}
+	if want := `version = "1.0.0-rc1"`; !strings.Contains(block, want) {
+		t.Errorf("lock block %q does not contain %q", block, want)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+)
+
+func runExport(ctx context.Context, g *globalOptions, args []string) error {
+	fs := newCommandFlagSet(g, "export", "export --output FILE [--provider REFERENCE]...")
+	var output string
+	var references stringSliceFlag
+	fs.StringVar(&output, "output", "", "Archive to write, or - for stdout")
+	fs.Var(&references, "provider", "Only export this provider (may be repeated)")
+	err := parseCommandFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		fs.Usage()
+		return &UsageError{fmt.Errorf("--output is required")}
+	}
+
+	config, _, err := g.setup()
+	if err != nil {
+		return err
+	}
+	configProviders, err := selectProviders(ctx, config, references, false)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if output != "-" {
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		out = f
+	}
+	gzw := gzip.NewWriter(out)
+	tw := tar.NewWriter(gzw)
+
+	failed := 0
+	for _, configProvider := range configProviders {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err = exportProvider(ctx, config, configProvider, tw)
+		if err != nil {
+			sugar.Errorf("%v", err)
+			failed++
+		}
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	err = gzw.Close()
+	if err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return &ProviderFailuresError{Failed: failed, Total: len(configProviders)}
+	}
+	return nil
+}
+
+// writes the valid binaries of a provider into the archive in the network mirror layout, along with a matching catalog
+func exportProvider(ctx context.Context, config Configuration, configProvider ProviderMirrorConfiguration, tw *tar.Writer) error {
+	provider, storage, catalog, err := loadConfiguredProviderCatalog(ctx, config, configProvider)
+	if err != nil {
+		return err
+	}
+	valid, invalid, err := storage.VerifyCatalogAgainstStorage(catalog)
+	if err != nil {
+		return fmt.Errorf("error verifying catalog against storage for provider %s: %w", provider, err)
+	}
+	for _, psib := range invalid {
+		sugar.Warnf("not exporting %s, it does not match the catalog", psib.ProviderSpecificInstance)
+	}
+
+	// archive paths always use forward slashes regardless of platform
+	base := path.Join(provider.Hostname, provider.Owner, provider.Name)
+	for _, psib := range valid {
+		data, err := storage.ReadProviderBinaryDataFromStorage(psib)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", psib.FullPath, err)
+		}
+		err = writeTarFile(tw, path.Join(base, psib.GetDownloadedFileName()), data)
+		if err != nil {
+			return err
+		}
+	}
+
+	mirrorIndex, versionArchives := commonBuildMirrorCatalog(valid)
+	for version, mirrorArchives := range versionArchives {
+		versionJson, err := json.MarshalIndent(mirrorArchives, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshalling version JSON: %w", err)
+		}
+		err = writeTarFile(tw, path.Join(base, fmt.Sprintf("%s.json", version)), versionJson)
+		if err != nil {
+			return err
+		}
+	}
+	mirrorIndexJson, err := json.MarshalIndent(mirrorIndex, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling mirror index JSON: %w", err)
+	}
+	return writeTarFile(tw, path.Join(base, mirrorIndexFile), mirrorIndexJson)
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("error writing archive header for %s: %w", name, err)
+	}
+	_, err = tw.Write(data)
+	if err != nil {
+		return fmt.Errorf("error writing %s to archive: %w", name, err)
+	}
+	return nil
+}
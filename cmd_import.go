@@ -0,0 +1,263 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// the contents of an archive for a single provider
+type importedProvider struct {
+	binaries map[string][]byte
+	archives map[string]MirrorArchives
+	// zips on disk by file name, which are read one at a time while importing rather than held in binaries
+	paths map[string]string
+}
+
+// the file names of the zips, in a stable order
+func (ip *importedProvider) filenames() []string {
+	filenames := make([]string, 0, len(ip.binaries)+len(ip.paths))
+	for filename := range ip.binaries {
+		filenames = append(filenames, filename)
+	}
+	for filename := range ip.paths {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	return filenames
+}
+
+func (ip *importedProvider) binary(filename string) ([]byte, error) {
+	if data, ok := ip.binaries[filename]; ok {
+		return data, nil
+	}
+	return os.ReadFile(ip.paths[filename])
+}
+
+func runImport(ctx context.Context, g *globalOptions, args []string) error {
+	fs := newCommandFlagSet(g, "import", "import --input FILE")
+	var input string
+	fs.StringVar(&input, "input", "", "Archive to read, or - for stdin")
+	err := parseCommandFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if input == "" {
+		fs.Usage()
+		return &UsageError{fmt.Errorf("--input is required")}
+	}
+
+	config, _, err := g.setup()
+	if err != nil {
+		return err
+	}
+
+	var in io.Reader = os.Stdin
+	if input != "-" {
+		f, err := os.Open(input)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		in = f
+	}
+
+	imported, err := readImportArchive(in)
+	if err != nil {
+		return err
+	}
+
+	providers := make([]Provider, 0, len(imported))
+	for provider := range imported {
+		providers = append(providers, provider)
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].String() < providers[j].String()
+	})
+
+	storageCtx, cancel := withGracePeriod(ctx, storageShutdownGracePeriod)
+	defer cancel()
+
+	failed := 0
+	for _, provider := range providers {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err = importProvider(ctx, storageCtx, config, provider, imported[provider])
+		if err != nil {
+			sugar.Errorf("%v", err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return &ProviderFailuresError{Failed: failed, Total: len(providers)}
+	}
+	return nil
+}
+
+// reads an archive in the layout written by export, i.e. HOSTNAME/NAMESPACE/TYPE/FILE
+func readImportArchive(in io.Reader) (map[Provider]*importedProvider, error) {
+	gzr, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, fmt.Errorf("error opening archive: %w", err)
+	}
+	tr := tar.NewReader(gzr)
+
+	imported := make(map[Provider]*importedProvider)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		// the name is not cleaned first, so that an entry such as a/../../b cannot end up outside the mirror
+		parts := strings.Split(header.Name, "/")
+		for _, part := range parts {
+			if part == "" || part == "." || part == ".." {
+				return nil, fmt.Errorf("unsafe path %q in archive", header.Name)
+			}
+		}
+		if len(parts) != 4 {
+			sugar.Warnf("ignoring %s in archive, it is not of the form HOSTNAME/NAMESPACE/TYPE/FILE", header.Name)
+			continue
+		}
+		provider := Provider{Hostname: parts[0], Owner: parts[1], Name: parts[2]}
+		err = provider.validateAddress()
+		if err != nil {
+			return nil, fmt.Errorf("%s in archive: %w", header.Name, err)
+		}
+		filename := parts[3]
+		if _, ok := imported[provider]; !ok {
+			imported[provider] = &importedProvider{
+				binaries: make(map[string][]byte),
+				archives: make(map[string]MirrorArchives),
+			}
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s from archive: %w", header.Name, err)
+		}
+
+		switch {
+		case strings.HasSuffix(filename, ".zip"):
+			imported[provider].binaries[filename] = data
+		case filename == mirrorIndexFile:
+			// the index is rebuilt from what actually gets imported
+		case strings.HasSuffix(filename, ".json"):
+			var archives MirrorArchives
+			err = json.Unmarshal(data, &archives)
+			if err != nil {
+				return nil, fmt.Errorf("error unmarshalling %s from archive: %w", header.Name, err)
+			}
+			imported[provider].archives[strings.TrimSuffix(filename, ".json")] = archives
+		default:
+			sugar.Warnf("ignoring unknown file %s in archive", header.Name)
+		}
+	}
+
+	return imported, nil
+}
+
+// writes the binaries for a provider to storage and merges them into its existing catalog; if ctx is cancelled
+// part way through, the catalog is still written for whatever was imported, using storageCtx
+func importProvider(ctx context.Context, storageCtx context.Context, config Configuration, provider Provider, imported *importedProvider) error {
+	err := provider.validateAddress()
+	if err != nil {
+		return err
+	}
+	storage, err := NewProviderStorer(storageCtx, config.DownloadDestination, provider, nil)
+	if err != nil {
+		return fmt.Errorf("error setting up storage for provider %s: %w", provider, err)
+	}
+
+	catalog := make(map[ProviderSpecificInstance]ProviderSpecificInstanceBinary)
+	existing, err := storage.LoadCatalog()
+	if err != nil {
+		sugar.Infof("initializing provider %s as fresh", provider)
+	}
+	for _, psib := range existing {
+		catalog[psib.ProviderSpecificInstance] = psib
+	}
+
+	failed := 0
+	written := 0
+	for _, filename := range imported.filenames() {
+		if ctx.Err() != nil {
+			break
+		}
+		pi, err := provider.ParseDownloadedFileName(filename)
+		if err != nil {
+			sugar.Errorf("skipping %s: %v", filename, err)
+			failed++
+			continue
+		}
+		data, err := imported.binary(filename)
+		if err != nil {
+			sugar.Errorf("error reading %s: %v", filename, err)
+			failed++
+			continue
+		}
+
+		// if the archive came with a catalog, the binary has to match it before anything is written, so that a
+		// bad binary never replaces a good one already in the mirror
+		expected, ok := imported.archives[pi.Version].Archives[fmt.Sprintf("%s_%s", pi.OS, pi.Arch)]
+		if ok {
+			h1, err := h1HashOfZip(data)
+			if err != nil {
+				sugar.Errorf("skipping %s, it is not a valid zip: %v", filename, err)
+				failed++
+				continue
+			}
+			if !StringInSlice(h1, expected.Hashes) {
+				sugar.Errorf("checksum mismatch for PVI %s: got %s, expected one of %v", pi, h1, expected.Hashes)
+				failed++
+				continue
+			}
+		}
+
+		psib, err := storage.WriteProviderBinaryDataToStorage(data, pi)
+		if err != nil {
+			sugar.Errorf("error writing binary data to storage for PVI %s: %v", pi, err)
+			failed++
+			continue
+		}
+
+		sugar.Infof("imported PVI %s", pi)
+		catalog[pi] = *psib
+		written++
+	}
+
+	if written > 0 {
+		psibs := make([]ProviderSpecificInstanceBinary, 0, len(catalog))
+		for _, psib := range catalog {
+			psibs = append(psibs, psib)
+		}
+		err = storage.StoreCatalog(psibs)
+		if err != nil {
+			return fmt.Errorf("error writing catalog for provider %s: %w", provider, err)
+		}
+	}
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("import of provider %s was interrupted: %w", provider, ctx.Err())
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to import %d instances of provider %s", failed, provider)
+	}
+	return nil
+}
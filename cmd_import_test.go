@@ -0,0 +1,186 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"testing"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	p := testProvider()
+	sourceConfig := Configuration{
+		Providers: []ProviderMirrorConfiguration{
+			{Reference: "aws", VersionRange: ">=5.0.0", OSArchs: []HCTFProviderPlatform{{OS: "linux", Arch: "amd64"}}},
+		},
+		DownloadDestination: DownloadDestination{Type: STORAGE_TYPE_FS, FSConfig: fsConfig{DownloadRoot: t.TempDir()}},
+	}
+	destConfig := Configuration{
+		DownloadDestination: DownloadDestination{Type: STORAGE_TYPE_FS, FSConfig: fsConfig{DownloadRoot: t.TempDir()}},
+	}
+
+	source, err := NewProviderStorer(t.Context(), sourceConfig.DownloadDestination, p, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var psibs []ProviderSpecificInstanceBinary
+	for _, version := range []string{"5.0.0", "5.1.0"} {
+		data, _ := createTestZip(t, "terraform-provider-aws", "binary "+version)
+		pi := ProviderSpecificInstance{Provider: p, Version: version, OS: "linux", Arch: "amd64"}
+		psib, err := source.WriteProviderBinaryDataToStorage(data, pi)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		psibs = append(psibs, *psib)
+	}
+	err = source.StoreCatalog(psibs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var archive bytes.Buffer
+	gzw := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gzw)
+	err = exportProvider(t.Context(), sourceConfig, sourceConfig.Providers[0], tw)
+	if err != nil {
+		t.Fatalf("unexpected export error: %v", err)
+	}
+	_ = tw.Close()
+	_ = gzw.Close()
+
+	imported, err := readImportArchive(&archive)
+	if err != nil {
+		t.Fatalf("unexpected error reading archive: %v", err)
+	}
+	if len(imported) != 1 || imported[p] == nil {
+		t.Fatalf("expected exactly provider %s in archive, got %v", p, imported)
+	}
+	if len(imported[p].binaries) != 2 {
+		t.Errorf("expected 2 binaries in archive, got %d", len(imported[p].binaries))
+	}
+
+	err = importProvider(t.Context(), t.Context(), destConfig, p, imported[p])
+	if err != nil {
+		t.Fatalf("unexpected import error: %v", err)
+	}
+
+	dest, err := NewProviderStorer(t.Context(), destConfig.DownloadDestination, p, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	catalog, err := dest.LoadCatalog()
+	if err != nil {
+		t.Fatalf("unexpected error loading imported catalog: %v", err)
+	}
+	valid, invalid, err := dest.VerifyCatalogAgainstStorage(catalog)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(valid) != 2 || len(invalid) != 0 {
+		t.Errorf("got %d valid and %d invalid, want 2 and 0", len(valid), len(invalid))
+	}
+}
+
+func TestImportProviderRejectsChecksumMismatch(t *testing.T) {
+	p := testProvider()
+	config := Configuration{
+		DownloadDestination: DownloadDestination{Type: STORAGE_TYPE_FS, FSConfig: fsConfig{DownloadRoot: t.TempDir()}},
+	}
+	data, _ := createTestZip(t, "terraform-provider-aws", "binary")
+	imported := &importedProvider{
+		binaries: map[string][]byte{"terraform-provider-aws_5.0.0_linux_amd64.zip": data},
+		archives: map[string]MirrorArchives{
+			"5.0.0": {Archives: map[string]MirrorProviderPlatformArch{
+				"linux_amd64": {Hashes: []string{"h1:wrong"}, URL: "terraform-provider-aws_5.0.0_linux_amd64.zip"},
+			}},
+		},
+	}
+
+	err := importProvider(t.Context(), t.Context(), config, p, imported)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	// the hash is checked before anything is written
+	entries, err := os.ReadDir(config.DownloadDestination.FSConfig.DownloadRoot)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected nothing to be written, got %v", entries)
+	}
+}
+
+func TestReadImportArchiveRejectsUnsafePaths(t *testing.T) {
+	for _, name := range []string{
+		"../evil/aws/terraform-provider-aws_5.0.0_linux_amd64.zip",
+		"registry.terraform.io/../../aws/terraform-provider-aws_5.0.0_linux_amd64.zip",
+		"/registry.terraform.io/hashicorp/aws/terraform-provider-aws_5.0.0_linux_amd64.zip",
+		"registry.terraform.io/./aws/x/terraform-provider-aws_5.0.0_linux_amd64.zip",
+		"registry.terraform.io//aws/terraform-provider-aws_5.0.0_linux_amd64.zip",
+		`registry.terraform.io/hashi\..\corp/aws/terraform-provider-aws_5.0.0_linux_amd64.zip`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			var archive bytes.Buffer
+			gzw := gzip.NewWriter(&archive)
+			tw := tar.NewWriter(gzw)
+			_ = tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: 1})
+			_, _ = tw.Write([]byte("x"))
+			_ = tw.Close()
+			_ = gzw.Close()
+
+			_, err := readImportArchive(&archive)
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestImportProviderMismatchKeepsExistingBinary(t *testing.T) {
+	p := testProvider()
+	config := Configuration{
+		DownloadDestination: DownloadDestination{Type: STORAGE_TYPE_FS, FSConfig: fsConfig{DownloadRoot: t.TempDir()}},
+	}
+	storage, err := NewProviderStorer(t.Context(), config.DownloadDestination, p, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	good, _ := createTestZip(t, "terraform-provider-aws", "good binary")
+	pi := ProviderSpecificInstance{Provider: p, Version: "5.0.0", OS: "linux", Arch: "amd64"}
+	psib, err := storage.WriteProviderBinaryDataToStorage(good, pi)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = storage.StoreCatalog([]ProviderSpecificInstanceBinary{*psib})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bad, _ := createTestZip(t, "terraform-provider-aws", "bad binary")
+	imported := &importedProvider{
+		binaries: map[string][]byte{pi.GetDownloadedFileName(): bad},
+		archives: map[string]MirrorArchives{
+			"5.0.0": {Archives: map[string]MirrorProviderPlatformArch{
+				"linux_amd64": {Hashes: []string{"h1:wrong"}, URL: pi.GetDownloadedFileName()},
+			}},
+		},
+	}
+	err = importProvider(t.Context(), t.Context(), config, p, imported)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	catalog, err := storage.LoadCatalog()
+	if err != nil {
+		t.Fatalf("unexpected error loading catalog: %v", err)
+	}
+	valid, invalid, err := storage.VerifyCatalogAgainstStorage(catalog)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(valid) != 1 || len(invalid) != 0 || valid[0].H1Checksum != psib.H1Checksum {
+		t.Errorf("expected the existing binary to be left alone, got %d valid and %d invalid", len(valid), len(invalid))
+	}
+}
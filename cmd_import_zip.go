@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+func runImportZip(ctx context.Context, g *globalOptions, args []string) error {
+	fs := newCommandFlagSet(g, "import-zip", "import-zip --dir DIR --namespace NAMESPACE [--hostname HOSTNAME]")
+	var dir string
+	var namespace string
+	var hostname string
+	fs.StringVar(&dir, "dir", "", "Directory containing terraform-provider-NAME_VERSION_OS_ARCH.zip files")
+	fs.StringVar(&namespace, "namespace", "", "Namespace to mirror the providers under")
+	fs.StringVar(&hostname, "hostname", "", "Hostname to mirror the providers under (defaults to default_provider_hostname from the config)")
+	err := parseCommandFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if dir == "" || namespace == "" {
+		err = fmt.Errorf("--dir and --namespace are required")
+		fmt.Fprintf(fs.Output(), "%v\n", err)
+		fs.Usage()
+		return &UsageError{err}
+	}
+
+	config, _, err := g.setup()
+	if err != nil {
+		return err
+	}
+	if hostname == "" {
+		hostname = config.DefaultProviderHostname
+	}
+	if hostname == "" {
+		hostname = defaultProviderHostname
+	}
+
+	imported, err := readImportZipDir(dir, hostname, namespace)
+	if err != nil {
+		return err
+	}
+	if len(imported) == 0 {
+		return fmt.Errorf("no provider zips found in %s", dir)
+	}
+
+	providers := make([]Provider, 0, len(imported))
+	for provider := range imported {
+		providers = append(providers, provider)
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].String() < providers[j].String()
+	})
+
+	storageCtx, cancel := withGracePeriod(ctx, storageShutdownGracePeriod)
+	defer cancel()
+
+	failed := 0
+	for _, provider := range providers {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err = importProvider(ctx, storageCtx, config, provider, imported[provider])
+		if err != nil {
+			sugar.Errorf("%v", err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return &ProviderFailuresError{Failed: failed, Total: len(providers)}
+	}
+	return nil
+}
+
+// finds the provider zips in dir and groups them by provider. Every zip has to be named like the files that
+// registries serve and be a readable zip, so that nothing half-broken ends up in the mirror; the h1 and zh
+// hashes of each are printed for use in lock files. The zips are hashed from disk and not kept in memory; the
+// h1 hashes are what importProvider checks each zip against when it reads it again to write it.
+func readImportZipDir(dir string, hostname string, namespace string) (map[Provider]*importedProvider, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	imported := make(map[Provider]*importedProvider)
+	var problems []string
+	for _, entry := range entries {
+		filename := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(filename, ".zip") {
+			continue
+		}
+
+		name, _, _ := strings.Cut(strings.TrimPrefix(filename, "terraform-provider-"), "_")
+		provider := Provider{Hostname: hostname, Owner: namespace, Name: name}
+		pi, err := provider.ParseDownloadedFileName(filename)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+
+		zipPath := filepath.Join(dir, filename)
+		h1, err := dirhash.HashZip(zipPath, dirhash.Hash1)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s is not a valid zip: %v", filename, err))
+			continue
+		}
+		zh, err := zhHashOfZipFile(zipPath)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("%s %s %s %s\n", pi.Provider, filename, h1, zh)
+
+		if _, ok := imported[provider]; !ok {
+			imported[provider] = &importedProvider{
+				archives: make(map[string]MirrorArchives),
+				paths:    make(map[string]string),
+			}
+		}
+		imported[provider].paths[filename] = zipPath
+		if _, ok := imported[provider].archives[pi.Version]; !ok {
+			imported[provider].archives[pi.Version] = MirrorArchives{Archives: make(map[string]MirrorProviderPlatformArch)}
+		}
+		imported[provider].archives[pi.Version].Archives[fmt.Sprintf("%s_%s", pi.OS, pi.Arch)] = MirrorProviderPlatformArch{
+			Hashes: []string{h1},
+			URL:    filename,
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid provider zips in %s:\n  %s", dir, strings.Join(problems, "\n  "))
+	}
+	return imported, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadImportZipDir(t *testing.T) {
+	writeZip := func(t *testing.T, dir, filename string) {
+		t.Helper()
+		data, _ := createTestZip(t, "terraform-provider-internal", "binary "+filename)
+		if err := os.WriteFile(filepath.Join(dir, filename), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("valid zips are grouped by provider", func(t *testing.T) {
+		dir := t.TempDir()
+		writeZip(t, dir, "terraform-provider-internal_1.0.0_linux_amd64.zip")
+		writeZip(t, dir, "terraform-provider-internal_1.0.0_darwin_arm64.zip")
+		writeZip(t, dir, "terraform-provider-other_0.1.0_linux_amd64.zip")
+		if err := os.WriteFile(filepath.Join(dir, "SHA256SUMS"), []byte("ignored"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		imported, err := readImportZipDir(dir, "registry.example.com", "corp")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		internal := Provider{Hostname: "registry.example.com", Owner: "corp", Name: "internal"}
+		other := Provider{Hostname: "registry.example.com", Owner: "corp", Name: "other"}
+		if len(imported) != 2 || imported[internal] == nil || imported[other] == nil {
+			t.Fatalf("unexpected providers %v", imported)
+		}
+		if len(imported[internal].paths) != 2 || len(imported[internal].binaries) != 0 {
+			t.Errorf("got %d paths and %d binaries in memory for %s, want 2 and 0", len(imported[internal].paths), len(imported[internal].binaries), internal)
+		}
+		if hashes := imported[internal].archives["1.0.0"].Archives["darwin_arm64"].Hashes; len(hashes) != 1 {
+			t.Errorf("expected the h1 hash of each zip to be recorded, got %v", hashes)
+		}
+	})
+
+	tests := []struct {
+		name     string
+		filename string
+		contents []byte
+		wantErr  string
+	}{
+		{"wrong prefix", "internal_1.0.0_linux_amd64.zip", nil, "does not start with terraform-provider-"},
+		{"missing platform", "terraform-provider-internal_1.0.0_linux.zip", nil, "is not of the form"},
+		{"invalid version", "terraform-provider-internal_one_linux_amd64.zip", nil, "invalid version"},
+		{"not a zip", "terraform-provider-internal_1.0.0_linux_amd64.zip", []byte("not a zip"), "is not a valid zip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.contents != nil {
+				if err := os.WriteFile(filepath.Join(dir, tt.filename), tt.contents, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				writeZip(t, dir, tt.filename)
+			}
+
+			_, err := readImportZipDir(dir, "registry.example.com", "corp")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestImportZipIntoStorage(t *testing.T) {
+	dir := t.TempDir()
+	data, h1 := createTestZip(t, "terraform-provider-internal", "binary")
+	if err := os.WriteFile(filepath.Join(dir, "terraform-provider-internal_1.0.0_linux_amd64.zip"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := Configuration{
+		DownloadDestination: DownloadDestination{Type: STORAGE_TYPE_FS, FSConfig: fsConfig{DownloadRoot: t.TempDir()}},
+	}
+
+	imported, err := readImportZipDir(dir, "registry.example.com", "corp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := Provider{Hostname: "registry.example.com", Owner: "corp", Name: "internal"}
+	err = importProvider(t.Context(), t.Context(), config, provider, imported[provider])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	storage, err := NewProviderStorer(t.Context(), config.DownloadDestination, provider, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog, err := storage.LoadCatalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(catalog) != 1 || catalog[0].Version != "1.0.0" || catalog[0].H1Checksum != h1 {
+		t.Errorf("unexpected catalog %+v", catalog)
+	}
+}
+
+func TestImportZipChangedAfterReading(t *testing.T) {
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "terraform-provider-internal_1.0.0_linux_amd64.zip")
+	data, _ := createTestZip(t, "terraform-provider-internal", "binary")
+	if err := os.WriteFile(zipPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := Configuration{
+		DownloadDestination: DownloadDestination{Type: STORAGE_TYPE_FS, FSConfig: fsConfig{DownloadRoot: t.TempDir()}},
+	}
+
+	imported, err := readImportZipDir(dir, "registry.example.com", "corp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the zip is replaced between the check and the import, e.g. by a build that is still running
+	changed, _ := createTestZip(t, "terraform-provider-internal", "rebuilt binary")
+	if err := os.WriteFile(zipPath, changed, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	provider := Provider{Hostname: "registry.example.com", Owner: "corp", Name: "internal"}
+	err = importProvider(t.Context(), t.Context(), config, provider, imported[provider])
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	entries, err := os.ReadDir(config.DownloadDestination.FSConfig.DownloadRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected nothing to be written, got %v", entries)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	semver "github.com/blang/semver/v4"
+)
+
+// a single row of list output
+type ListEntry struct {
+	Provider   string    `json:"provider"`
+	Version    string    `json:"version"`
+	Platform   string    `json:"platform"`
+	H1Checksum string    `json:"hash"`
+	Size       int64     `json:"size"`
+	MirroredAt time.Time `json:"mirrored_at"`
+	Path       string    `json:"path"`
+}
+
+// narrows down what list prints, zero values match everything
+type listFilter struct {
+	versionRange semver.Range
+	platforms    []string
+}
+
+func (f listFilter) matches(psib ProviderSpecificInstanceBinary) bool {
+	if f.versionRange != nil {
+		version, err := semver.Parse(psib.Version)
+		if err != nil || !f.versionRange(version) {
+			return false
+		}
+	}
+	if len(f.platforms) > 0 && !StringInSlice(fmt.Sprintf("%s_%s", psib.OS, psib.Arch), f.platforms) {
+		return false
+	}
+	return true
+}
+
+func runList(ctx context.Context, g *globalOptions, args []string) error {
+	fs := newCommandFlagSet(g, "list", "list [--provider REFERENCE]... [--version RANGE] [--platform OS_ARCH]... [--format table|json|csv]")
+	var references stringSliceFlag
+	var versionRange string
+	var platforms stringSliceFlag
+	var format string
+	fs.Var(&references, "provider", "Only list this provider (may be repeated)")
+	fs.StringVar(&versionRange, "version", "", "Only list versions in this semver range, e.g. '>=5.0.0 <6.0.0'")
+	fs.Var(&platforms, "platform", "Only list this platform, e.g. darwin_arm64 (may be repeated)")
+	fs.StringVar(&format, "format", "table", "Output format (table, json or csv)")
+	err := parseCommandFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if !StringInSlice(format, []string{"table", "json", "csv"}) {
+		err = fmt.Errorf("%s is not a valid output format", format)
+		fmt.Fprintf(fs.Output(), "%v\n", err)
+		return &UsageError{err}
+	}
+
+	filter := listFilter{platforms: platforms}
+	if versionRange != "" {
+		filter.versionRange, err = semver.ParseRange(versionRange)
+		if err != nil {
+			err = fmt.Errorf("invalid version range %q: %w", versionRange, err)
+			fmt.Fprintf(fs.Output(), "%v\n", err)
+			return &UsageError{err}
+		}
+	}
+
+	config, _, err := g.setup()
+	if err != nil {
+		return err
+	}
+	configProviders, err := selectProviders(ctx, config, references, true)
+	if err != nil {
+		return err
+	}
+
+	entries := []ListEntry{}
+	failed := 0
+	for _, configProvider := range configProviders {
+		provider, _, catalog, err := loadConfiguredProviderCatalog(ctx, config, configProvider)
+		if err != nil {
+			sugar.Errorf("%v", err)
+			failed++
+			continue
+		}
+		sortCatalog(catalog)
+		for _, psib := range catalog {
+			if !filter.matches(psib) {
+				continue
+			}
+			entries = append(entries, ListEntry{
+				Provider:   provider.String(),
+				Version:    psib.Version,
+				Platform:   fmt.Sprintf("%s_%s", psib.OS, psib.Arch),
+				H1Checksum: psib.H1Checksum,
+				Size:       psib.Size,
+				MirroredAt: psib.MirroredAt,
+				Path:       psib.FullPath,
+			})
+		}
+	}
+
+	err = writeListEntries(os.Stdout, format, entries)
+	if err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return &ProviderFailuresError{Failed: failed, Total: len(configProviders)}
+	}
+	return nil
+}
+
+func writeListEntries(out io.Writer, format string, entries []ListEntry) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	case "csv":
+		w := csv.NewWriter(out)
+		err := w.Write([]string{"provider", "version", "platform", "hash", "size", "mirrored_at", "path"})
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			err = w.Write([]string{e.Provider, e.Version, e.Platform, e.H1Checksum, strconv.FormatInt(e.Size, 10), formatMirroredAt(e.MirroredAt), e.Path})
+			if err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		return w.Error()
+	default:
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "PROVIDER\tVERSION\tPLATFORM\tSIZE\tMIRRORED AT\tHASH")
+		for _, e := range entries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", e.Provider, e.Version, e.Platform, e.Size, formatMirroredAt(e.MirroredAt), e.H1Checksum)
+		}
+		return w.Flush()
+	}
+}
+
+// catalogs written before timestamps were recorded have no mirror time, which shows up as blank rather than year 1
+func formatMirroredAt(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// orders catalog entries by semantic version and then platform, falling back to plain string order for unparseable versions
+func sortCatalog(catalog []ProviderSpecificInstanceBinary) {
+	sort.Slice(catalog, func(i, j int) bool {
+		a, b := catalog[i], catalog[j]
+		if a.Version != b.Version {
+			av, aErr := semver.Parse(a.Version)
+			bv, bErr := semver.Parse(b.Version)
+			if aErr != nil || bErr != nil {
+				return a.Version < b.Version
+			}
+			return av.LT(bv)
+		}
+		if a.OS != b.OS {
+			return a.OS < b.OS
+		}
+		return a.Arch < b.Arch
+	})
+}
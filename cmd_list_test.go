@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	semver "github.com/blang/semver/v4"
+)
+
+func TestListFilterMatches(t *testing.T) {
+	p := testProvider()
+	makePSIB := func(version, os, arch string) ProviderSpecificInstanceBinary {
+		return ProviderSpecificInstanceBinary{
+			ProviderSpecificInstance: ProviderSpecificInstance{Provider: p, Version: version, OS: os, Arch: arch},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		filter   listFilter
+		psib     ProviderSpecificInstanceBinary
+		expected bool
+	}{
+		{"empty filter matches everything", listFilter{}, makePSIB("5.0.0", "linux", "amd64"), true},
+		{"version in range", listFilter{versionRange: semver.MustParseRange(">=5.0.0")}, makePSIB("5.0.0", "linux", "amd64"), true},
+		{"version out of range", listFilter{versionRange: semver.MustParseRange(">=5.0.0")}, makePSIB("4.0.0", "linux", "amd64"), false},
+		{"platform matches", listFilter{platforms: []string{"darwin_arm64"}}, makePSIB("5.0.0", "darwin", "arm64"), true},
+		{"platform does not match", listFilter{platforms: []string{"darwin_arm64"}}, makePSIB("5.0.0", "linux", "amd64"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.filter.matches(tt.psib)
+			if got != tt.expected {
+				t.Errorf("matches() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWriteListEntries(t *testing.T) {
+	mirroredAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	entries := []ListEntry{
+		{Provider: "registry.terraform.io/hashicorp/aws", Version: "5.0.0", Platform: "linux_amd64", H1Checksum: "h1:abc", Size: 1234, MirroredAt: mirroredAt, Path: "/mirror/aws.zip"},
+		{Provider: "registry.terraform.io/hashicorp/aws", Version: "5.1.0", Platform: "linux_amd64", H1Checksum: "h1:def"},
+	}
+
+	t.Run("json", func(t *testing.T) {
+		var out bytes.Buffer
+		err := writeListEntries(&out, "json", entries)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var decoded []ListEntry
+		err = json.Unmarshal(out.Bytes(), &decoded)
+		if err != nil {
+			t.Fatalf("output is not valid JSON: %v", err)
+		}
+		if len(decoded) != 2 || decoded[0] != entries[0] {
+			t.Errorf("got %+v, want %+v", decoded, entries)
+		}
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		var out bytes.Buffer
+		err := writeListEntries(&out, "csv", entries)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := "provider,version,platform,hash,size,mirrored_at,path\n" +
+			"registry.terraform.io/hashicorp/aws,5.0.0,linux_amd64,h1:abc,1234,2024-01-02T03:04:05Z,/mirror/aws.zip\n" +
+			"registry.terraform.io/hashicorp/aws,5.1.0,linux_amd64,h1:def,0,,\n"
+		if out.String() != expected {
+			t.Errorf("got\n%s\nwant\n%s", out.String(), expected)
+		}
+	})
+
+	t.Run("table", func(t *testing.T) {
+		var out bytes.Buffer
+		err := writeListEntries(&out, "table", entries)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if len(lines) != 3 {
+			t.Fatalf("expected header and 2 rows, got %d lines", len(lines))
+		}
+		if !strings.HasPrefix(lines[0], "PROVIDER") || !strings.Contains(lines[1], "2024-01-02T03:04:05Z") {
+			t.Errorf("unexpected table output:\n%s", out.String())
+		}
+	})
+}
+
+func TestSortCatalog(t *testing.T) {
+	p := testProvider()
+	catalog := []ProviderSpecificInstanceBinary{
+		{ProviderSpecificInstance: ProviderSpecificInstance{Provider: p, Version: "5.10.0", OS: "linux", Arch: "amd64"}},
+		{ProviderSpecificInstance: ProviderSpecificInstance{Provider: p, Version: "5.2.0", OS: "linux", Arch: "amd64"}},
+		{ProviderSpecificInstance: ProviderSpecificInstance{Provider: p, Version: "5.2.0", OS: "darwin", Arch: "arm64"}},
+	}
+	sortCatalog(catalog)
+
+	got := []string{}
+	for _, psib := range catalog {
+		got = append(got, psib.Version+" "+psib.OS)
+	}
+	expected := []string{"5.2.0 darwin", "5.2.0 linux", "5.10.0 linux"}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("got %v, want %v", got, expected)
+	}
+}
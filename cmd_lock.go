@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	semver "github.com/blang/semver/v4"
+)
+
+func runLock(ctx context.Context, g *globalOptions, args []string) error {
+	fs := newCommandFlagSet(g, "lock", "lock [--output FILE] [--platform OS_ARCH]... [--provider REFERENCE]...")
+	var output string
+	var platforms stringSliceFlag
+	var references stringSliceFlag
+	fs.StringVar(&output, "output", "-", "File to write, or - for stdout")
+	fs.Var(&platforms, "platform", "Only include hashes for this platform, e.g. linux_amd64 (may be repeated)")
+	fs.Var(&references, "provider", "Only lock this provider (may be repeated)")
+	err := parseCommandFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	config, _, err := g.setup()
+	if err != nil {
+		return err
+	}
+	configProviders, err := selectProviders(ctx, config, references, false)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString("# This file is maintained automatically by \"terraform init\".\n# Manual edits may be lost in future updates.\n")
+
+	failed := 0
+	for _, configProvider := range configProviders {
+		provider, _, catalog, err := loadConfiguredProviderCatalog(ctx, config, configProvider)
+		if err != nil {
+			sugar.Errorf("%v", err)
+			failed++
+			continue
+		}
+		block, err := renderLockBlock(provider, catalog, configProvider, platforms)
+		if err != nil {
+			sugar.Errorf("error locking provider %s: %v", provider, err)
+			failed++
+			continue
+		}
+		b.WriteString("\n")
+		b.WriteString(block)
+	}
+
+	var out io.Writer = os.Stdout
+	if output != "-" {
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		out = f
+	}
+	_, err = io.WriteString(out, b.String())
+	if err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return &ProviderFailuresError{Failed: failed, Total: len(configProviders)}
+	}
+	return nil
+}
+
+// renders a lock file provider block pinning the newest mirrored version that any of the provider's stanzas allows
+func renderLockBlock(provider Provider, catalog []ProviderSpecificInstanceBinary, configProvider ProviderMirrorConfiguration, platforms []string) (string, error) {
+	var newest *semver.Version
+	for _, stanza := range configProvider.stanzas() {
+		parsedRange, err := semver.ParseRange(stanza.VersionRange)
+		if err != nil {
+			return "", err
+		}
+		for _, psib := range catalog {
+			version, err := semver.Parse(psib.Version)
+			if err != nil || !parsedRange(version) || StringInSlice(psib.Version, stanza.SkipVersions) {
+				continue
+			}
+			if newest == nil || version.GT(*newest) {
+				newest = &version
+			}
+		}
+	}
+	if newest == nil {
+		return "", fmt.Errorf("no mirrored version matches %s", configProvider.upstreamQuery().VersionRange)
+	}
+
+	var hashes []string
+	for _, psib := range catalog {
+		if psib.Version != newest.String() {
+			continue
+		}
+		if len(platforms) > 0 && !StringInSlice(fmt.Sprintf("%s_%s", psib.OS, psib.Arch), platforms) {
+			continue
+		}
+		hashes = append(hashes, psib.H1Checksum)
+	}
+	if len(hashes) == 0 {
+		return "", fmt.Errorf("version %s has no mirrored binaries for the requested platforms", newest)
+	}
+	sort.Strings(hashes)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "provider %q {\n", fmt.Sprintf("%s/%s/%s", provider.Hostname, provider.Owner, provider.Name))
+	fmt.Fprintf(&b, "  version = %q\n", newest.String())
+	b.WriteString("  hashes = [\n")
+	for _, hash := range hashes {
+		fmt.Fprintf(&b, "    %q,\n", hash)
+	}
+	b.WriteString("  ]\n}\n")
+	return b.String(), nil
+}
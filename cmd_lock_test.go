@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRenderLockBlock(t *testing.T) {
+	p := Provider{Hostname: "registry.terraform.io", Owner: "hashicorp", Name: "aws"}
+	makePSIB := func(version, os, arch, hash string) ProviderSpecificInstanceBinary {
+		return ProviderSpecificInstanceBinary{
+			ProviderSpecificInstance: ProviderSpecificInstance{Provider: p, Version: version, OS: os, Arch: arch},
+			H1Checksum:               hash,
+		}
+	}
+	catalog := []ProviderSpecificInstanceBinary{
+		makePSIB("5.0.0", "linux", "amd64", "h1:old"),
+		makePSIB("5.1.0", "linux", "amd64", "h1:bbb"),
+		makePSIB("5.1.0", "darwin", "arm64", "h1:aaa"),
+		makePSIB("6.0.0", "linux", "amd64", "h1:new"),
+	}
+
+	t.Run("newest version in range with all platforms", func(t *testing.T) {
+		got, err := renderLockBlock(p, catalog, ProviderMirrorConfiguration{VersionRange: "<6.0.0"}, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := `provider "registry.terraform.io/hashicorp/aws" {
+  version = "5.1.0"
+  hashes = [
+    "h1:aaa",
+    "h1:bbb",
+  ]
+}
+`
+		if got != expected {
+			t.Errorf("got\n%s\nwant\n%s", got, expected)
+		}
+	})
+
+	t.Run("skipped versions are not locked", func(t *testing.T) {
+		got, err := renderLockBlock(p, catalog, ProviderMirrorConfiguration{VersionRange: ">=5.0.0", SkipVersions: []string{"6.0.0", "5.1.0"}}, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := `provider "registry.terraform.io/hashicorp/aws" {
+  version = "5.0.0"
+  hashes = [
+    "h1:old",
+  ]
+}
+`
+		if got != expected {
+			t.Errorf("got\n%s\nwant\n%s", got, expected)
+		}
+	})
+
+	t.Run("platform filter", func(t *testing.T) {
+		got, err := renderLockBlock(p, catalog, ProviderMirrorConfiguration{VersionRange: "<6.0.0"}, []string{"darwin_arm64"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := `provider "registry.terraform.io/hashicorp/aws" {
+  version = "5.1.0"
+  hashes = [
+    "h1:aaa",
+  ]
+}
+`
+		if got != expected {
+			t.Errorf("got\n%s\nwant\n%s", got, expected)
+		}
+	})
+
+	t.Run("newest version any merged stanza allows", func(t *testing.T) {
+		configProvider := ProviderMirrorConfiguration{
+			VersionRange: "<5.1.0",
+			merged:       []ProviderMirrorConfiguration{{VersionRange: ">=6.0.0"}},
+		}
+		got, err := renderLockBlock(p, catalog, configProvider, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := `provider "registry.terraform.io/hashicorp/aws" {
+  version = "6.0.0"
+  hashes = [
+    "h1:new",
+  ]
+}
+`
+		if got != expected {
+			t.Errorf("got\n%s\nwant\n%s", got, expected)
+		}
+	})
+
+	t.Run("nothing in range", func(t *testing.T) {
+		_, err := renderLockBlock(p, catalog, ProviderMirrorConfiguration{VersionRange: ">=7.0.0"}, nil)
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+}
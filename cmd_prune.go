@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+func runPrune(ctx context.Context, g *globalOptions, args []string) error {
+	fs := newCommandFlagSet(g, "prune", "prune [--dry-run] [--provider REFERENCE]...")
+	var dryRun bool
+	var references stringSliceFlag
+	fs.BoolVar(&dryRun, "dry-run", false, "Only print what would be removed")
+	fs.Var(&references, "provider", "Only prune this provider (may be repeated)")
+	err := parseCommandFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	config, _, err := g.setup()
+	if err != nil {
+		return err
+	}
+	configProviders, err := selectConfiguredProviders(config, references)
+	if err != nil {
+		return err
+	}
+
+	storageCtx, cancel := withGracePeriod(ctx, storageShutdownGracePeriod)
+	defer cancel()
+
+	failed := 0
+	for _, configProvider := range configProviders {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err = pruneProvider(storageCtx, config, configProvider, dryRun)
+		if err != nil {
+			sugar.Errorf("%v", err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return &ProviderFailuresError{Failed: failed, Total: len(configProviders)}
+	}
+	return nil
+}
+
+// removes the binaries of a provider that no longer match its config and rewrites the catalog without them
+func pruneProvider(ctx context.Context, config Configuration, configProvider ProviderMirrorConfiguration, dryRun bool) error {
+	provider, storage, catalog, err := loadConfiguredProviderCatalog(ctx, config, configProvider)
+	if err != nil {
+		return err
+	}
+
+	keep, remove, err := partitionCatalogByConfig(provider, catalog, configProvider)
+	if err != nil {
+		return fmt.Errorf("error filtering catalog for provider %s: %w", provider, err)
+	}
+
+	for _, psib := range remove {
+		fmt.Printf("pruning %s\n", psib.ProviderSpecificInstance)
+	}
+	if dryRun || len(remove) == 0 {
+		return nil
+	}
+
+	// the catalog is written first so that an interrupted prune leaves unreferenced files behind rather than
+	// a catalog that points at files which are gone
+	err = storage.StoreCatalog(keep)
+	if err != nil {
+		return fmt.Errorf("error writing catalog for provider %s: %w", provider, err)
+	}
+	for _, psib := range remove {
+		err = storage.DeleteProviderBinaryFromStorage(psib)
+		if err != nil {
+			return fmt.Errorf("error deleting %s: %w", psib.FullPath, err)
+		}
+	}
+	return nil
+}
+
+// splits a catalog into the entries that the provider config still asks for and the ones it does not
+func partitionCatalogByConfig(
+	provider Provider,
+	catalog []ProviderSpecificInstanceBinary,
+	configProvider ProviderMirrorConfiguration,
+) (
+	keep []ProviderSpecificInstanceBinary,
+	remove []ProviderSpecificInstanceBinary,
+	err error,
+) {
+	// without os_archs a sync falls back to the platform it runs on, which would make a prune delete every
+	// other platform in the mirror
+	for _, stanza := range configProvider.stanzas() {
+		if len(stanza.OSArchs) == 0 {
+			return nil, nil, fmt.Errorf("refusing to prune provider %s, which does not have os_archs set; set them on the provider or under defaults", provider)
+		}
+	}
+
+	metadata := RemoteProviderMetadataFromCatalog(provider, catalog)
+	wanted, err := provider.wantedInstances(metadata, configProvider)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wantedSet := make(map[ProviderSpecificInstance]bool)
+	for _, pi := range wanted {
+		wantedSet[pi] = true
+	}
+	for _, psib := range catalog {
+		if wantedSet[psib.ProviderSpecificInstance] {
+			keep = append(keep, psib)
+		} else {
+			remove = append(remove, psib)
+		}
+	}
+
+	return keep, remove, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPartitionCatalogByConfig(t *testing.T) {
+	p := Provider{Hostname: "registry.terraform.io", Owner: "hashicorp", Name: "aws"}
+	makePSIB := func(version, os, arch string) ProviderSpecificInstanceBinary {
+		return ProviderSpecificInstanceBinary{
+			ProviderSpecificInstance: ProviderSpecificInstance{Provider: p, Version: version, OS: os, Arch: arch},
+		}
+	}
+	catalog := []ProviderSpecificInstanceBinary{
+		makePSIB("4.0.0", "linux", "amd64"),
+		makePSIB("5.0.0", "linux", "amd64"),
+		makePSIB("5.0.0", "darwin", "arm64"),
+		makePSIB("5.1.0", "linux", "amd64"),
+	}
+
+	tests := []struct {
+		name       string
+		pmc        ProviderMirrorConfiguration
+		wantKeep   int
+		wantRemove int
+		wantErr    bool
+	}{
+		{
+			"everything still wanted",
+			ProviderMirrorConfiguration{
+				Reference:    "aws",
+				VersionRange: ">=4.0.0",
+				OSArchs:      []HCTFProviderPlatform{{OS: "linux", Arch: "amd64"}, {OS: "darwin", Arch: "arm64"}},
+			},
+			4,
+			0,
+			false,
+		},
+		{
+			"versions out of range are removed",
+			ProviderMirrorConfiguration{
+				Reference:    "aws",
+				VersionRange: ">=5.0.0",
+				OSArchs:      []HCTFProviderPlatform{{OS: "linux", Arch: "amd64"}, {OS: "darwin", Arch: "arm64"}},
+			},
+			3,
+			1,
+			false,
+		},
+		{
+			"platforms no longer configured are removed",
+			ProviderMirrorConfiguration{
+				Reference:    "aws",
+				VersionRange: ">=4.0.0",
+				OSArchs:      []HCTFProviderPlatform{{OS: "linux", Arch: "amd64"}},
+			},
+			3,
+			1,
+			false,
+		},
+		{
+			"versions no longer kept by the policy are removed",
+			ProviderMirrorConfiguration{
+				Reference:    "aws",
+				VersionRange: ">=4.0.0",
+				OSArchs:      []HCTFProviderPlatform{{OS: "linux", Arch: "amd64"}, {OS: "darwin", Arch: "arm64"}},
+				Keep:         versionPolicyConfig{LatestPerMajor: true},
+			},
+			2,
+			2,
+			false,
+		},
+		{
+			"what any merged stanza wants is kept",
+			ProviderMirrorConfiguration{
+				Reference:    "aws",
+				VersionRange: ">=5.1.0",
+				OSArchs:      []HCTFProviderPlatform{{OS: "linux", Arch: "amd64"}},
+				merged: []ProviderMirrorConfiguration{{
+					Reference:    "hashicorp/aws",
+					VersionRange: "5.0.0",
+					OSArchs:      []HCTFProviderPlatform{{OS: "darwin", Arch: "arm64"}},
+				}},
+			},
+			2,
+			2,
+			false,
+		},
+		{
+			"no os_archs is refused rather than pruning to the host platform",
+			ProviderMirrorConfiguration{
+				Reference:    "aws",
+				VersionRange: ">=4.0.0",
+			},
+			0,
+			0,
+			true,
+		},
+		{
+			"no os_archs on a merged stanza is refused as well",
+			ProviderMirrorConfiguration{
+				Reference:    "aws",
+				VersionRange: ">=5.1.0",
+				OSArchs:      []HCTFProviderPlatform{{OS: "linux", Arch: "amd64"}},
+				merged:       []ProviderMirrorConfiguration{{Reference: "hashicorp/aws", VersionRange: "5.0.0"}},
+			},
+			0,
+			0,
+			true,
+		},
+		{
+			"invalid range",
+			ProviderMirrorConfiguration{
+				Reference:    "aws",
+				VersionRange: "not-a-range!!!",
+				OSArchs:      []HCTFProviderPlatform{{OS: "linux", Arch: "amd64"}},
+			},
+			0,
+			0,
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keep, remove, err := partitionCatalogByConfig(p, catalog, tt.pmc)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(keep) != tt.wantKeep {
+				t.Errorf("kept %d, want %d", len(keep), tt.wantKeep)
+			}
+			if len(remove) != tt.wantRemove {
+				t.Errorf("removed %d, want %d", len(remove), tt.wantRemove)
+			}
+		})
+	}
+}
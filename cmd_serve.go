@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func runServe(ctx context.Context, g *globalOptions, args []string) error {
+	fs := newCommandFlagSet(g, "serve", "serve [--listen-address ADDRESS] [--tls-cert-file FILE --tls-key-file FILE]")
+	var listenAddress string
+	var tlsCertFile string
+	var tlsKeyFile string
+	fs.StringVar(&listenAddress, "listen-address", ":8443", "Address to listen on")
+	fs.StringVar(&tlsCertFile, "tls-cert-file", "", "TLS certificate file")
+	fs.StringVar(&tlsKeyFile, "tls-key-file", "", "TLS private key file")
+	err := parseCommandFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if (tlsCertFile == "") != (tlsKeyFile == "") {
+		err = fmt.Errorf("--tls-cert-file and --tls-key-file must be given together")
+		fmt.Fprintf(fs.Output(), "%v\n", err)
+		fs.Usage()
+		return &UsageError{err}
+	}
+
+	config, _, err := g.setup()
+	if err != nil {
+		return err
+	}
+	if config.DownloadDestination.Type != STORAGE_TYPE_FS {
+		return &ConfigError{fmt.Errorf("serve only works with fs storage")}
+	}
+	if config.DownloadDestination.FSConfig.Layout == fsLayoutUnpacked {
+		return &ConfigError{fmt.Errorf("serve does not work with the unpacked layout, which Terraform only reads as a filesystem_mirror")}
+	}
+	server := &http.Server{
+		Addr:              listenAddress,
+		Handler:           mirrorFileServer(config.DownloadDestination.FSConfig.DownloadRoot),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), storageShutdownGracePeriod)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	if tlsCertFile == "" {
+		// Terraform will only talk to a mirror over HTTPS, so this is only useful behind something that terminates TLS
+		sugar.Warnf("serving %s over plain HTTP on %s", config.DownloadDestination.FSConfig.DownloadRoot, listenAddress)
+		err = server.ListenAndServe()
+	} else {
+		sugar.Infof("serving %s over HTTPS on %s", config.DownloadDestination.FSConfig.DownloadRoot, listenAddress)
+		err = server.ListenAndServeTLS(tlsCertFile, tlsKeyFile)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// serves the mirror, except for paths with a part that starts with a dot, which is never part of the mirror
+// protocol and is how tfspiegel names the files it keeps for itself
+func mirrorFileServer(root string) http.Handler {
+	files := http.FileServer(http.Dir(root))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, segment := range strings.Split(r.URL.Path, "/") {
+			if strings.HasPrefix(segment, ".") {
+				http.NotFound(w, r)
+				return
+			}
+		}
+		files.ServeHTTP(w, r)
+	})
+}
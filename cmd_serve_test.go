@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMirrorFileServer(t *testing.T) {
+	root := t.TempDir()
+	providerDir := filepath.Join(root, "registry.terraform.io", "hashicorp", "aws")
+	if err := os.MkdirAll(providerDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{mirrorIndexFile, ".tfspiegel-state.json"} {
+		if err := os.WriteFile(filepath.Join(providerDir, name), []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := mirrorFileServer(root)
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{"/registry.terraform.io/hashicorp/aws/index.json", http.StatusOK},
+		{"/registry.terraform.io/hashicorp/aws/.tfspiegel-state.json", http.StatusNotFound},
+		{"/registry.terraform.io/.hidden/aws/index.json", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", recorder.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestRunServeTLSFlagsTogether(t *testing.T) {
+	err := runServe(t.Context(), &globalOptions{}, []string{"--tls-cert-file", "cert.pem"})
+	var usageErr *UsageError
+	if !errors.As(err, &usageErr) || exitCodeForError(err) != exitCodeUsage {
+		t.Errorf("expected a usage error, got %v", err)
+	}
+}
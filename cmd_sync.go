@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+func runSync(ctx context.Context, g *globalOptions, args []string) error {
+	fs := newCommandFlagSet(g, "sync", "sync [--watch [--schedule CRON | --wait-between-loops DURATION] [--new-versions-schedule CRON]] [--listen-address ADDRESS] [--report PATH]")
+	var watch bool
+	var waitBetweenLoops time.Duration
+	var schedule string
+	var newVersionsSchedule string
+	var timezone string
+	var jitter time.Duration
+	var newVersionsOnly bool
+	var listenAddress string
+	var livenessTimeout time.Duration
+	var readinessMaxAge time.Duration
+	var reportPath string
+	var failOn string
+	fs.BoolVar(&watch, "watch", false, "Keep running and re-mirror providers on a schedule")
+	fs.DurationVar(&waitBetweenLoops, "wait-between-loops", 6*time.Hour, "How long to wait between mirroring attempts when watching without --schedule")
+	fs.StringVar(&schedule, "schedule", "", "Cron expression for full syncs when watching, e.g. '0 2 * * *' or '@every 6h'")
+	fs.StringVar(&newVersionsSchedule, "new-versions-schedule", "", "Cron expression for additional syncs that only fetch new versions and skip verification")
+	fs.StringVar(&timezone, "timezone", "", "Timezone the schedules are evaluated in, e.g. Europe/Berlin (defaults to local time)")
+	fs.DurationVar(&jitter, "jitter", 0, "Random delay of up to this long added to each scheduled sync")
+	fs.BoolVar(&newVersionsOnly, "new-versions-only", false, "Only fetch instances missing from the catalog, without verifying what is already stored")
+	fs.StringVar(&listenAddress, "listen-address", "", "Address to serve /metrics, /healthz and /readyz on, e.g. :9090 (disabled if empty)")
+	fs.DurationVar(&livenessTimeout, "liveness-timeout", time.Hour, "How long the sync may go without progress before /healthz fails")
+	fs.DurationVar(&readinessMaxAge, "readiness-max-age", 0, "How old the last finished sync may be before /readyz fails (defaults to twice the time between full syncs)")
+	fs.StringVar(&reportPath, "report", "", "Write a JSON report of each sync pass to this file, or to stdout if '-'")
+	fs.StringVar(&failOn, "fail-on", "any", "When failed providers make sync exit non-zero: any, total (only if every provider failed), a number of providers or a percentage such as 25%")
+	err := parseCommandFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	policy, err := parseFailurePolicy(failOn)
+	if err != nil {
+		fmt.Fprintf(fs.Output(), "%v\n", err)
+		fs.Usage()
+		return &UsageError{err}
+	}
+
+	var fullSchedule cron.Schedule = intervalSchedule{waitBetweenLoops}
+	if schedule != "" {
+		fullSchedule, err = parseSyncSchedule(schedule, timezone)
+		if err != nil {
+			fs.Usage()
+			return &UsageError{err}
+		}
+	}
+	var quickSchedule cron.Schedule
+	if newVersionsSchedule != "" {
+		quickSchedule, err = parseSyncSchedule(newVersionsSchedule, timezone)
+		if err != nil {
+			fs.Usage()
+			return &UsageError{err}
+		}
+	}
+
+	config, logger, err := g.setup()
+	if err != nil {
+		return err
+	}
+
+	scheduler := newSyncScheduler(fullSchedule, quickSchedule, jitter, time.Now())
+	if readinessMaxAge == 0 {
+		readinessMaxAge = 2 * scheduler.fullInterval()
+	}
+
+	reloader := newConfigReloader(g.configPath, config)
+
+	syncHealth.progress()
+	if listenAddress != "" {
+		server, err := startStatusServer(listenAddress, healthChecks{
+			status:          syncHealth,
+			livenessTimeout: livenessTimeout,
+			readinessMaxAge: readinessMaxAge,
+			destination: func() DownloadDestination {
+				return reloader.Current().DownloadDestination
+			},
+			storage: newStorageProbe(),
+		})
+		if err != nil {
+			return err
+		}
+		defer func() { _ = server.Close() }()
+	}
+
+	opts := SyncOptions{NewVersionsOnly: newVersionsOnly, ReportPath: reportPath}
+	if !watch {
+		err = MirrorProvidersWithConfig(ctx, config, logger, opts)
+		// a sync that a shutdown cut short has left providers out, which wrappers such as cron must not take
+		// for success; only the watch loop exits cleanly on a shutdown
+		if err != nil && ctx.Err() != nil {
+			return &InterruptedError{Err: err}
+		}
+		if ctx.Err() == nil && policy.tolerates(err) {
+			sugar.Warnf("%v, which is tolerated by --fail-on %s", err, failOn)
+			return nil
+		}
+		return err
+	}
+
+	err = reloader.Watch(ctx)
+	if err != nil {
+		return err
+	}
+
+	// the first pass always runs straight away, after that the schedule takes over
+	for {
+		// each pass picks up the config as it is when the pass starts; a reload during a pass only
+		// takes effect on the next one
+		err = MirrorProvidersWithConfig(ctx, reloader.Current(), logger, opts)
+		if ctx.Err() != nil {
+			sugar.Infof("shutting down")
+			return nil
+		}
+		syncHealth.finished()
+		// failures are logged and retried on the next loop rather than ending it, the
+		// failure policy only decides the exit code of a single sync
+		if err != nil {
+			sugar.Errorf("error mirroring providers: %v", err)
+		}
+
+		scheduler.ran(opts, time.Now())
+		var nextRun time.Time
+		nextRun, opts = scheduler.next()
+		opts.ReportPath = reportPath
+		metricNextSync.WithLabelValues(syncModeName(SyncOptions{})).Set(float64(scheduler.nextFull.Unix()))
+		if quickSchedule != nil {
+			metricNextSync.WithLabelValues(syncModeName(SyncOptions{NewVersionsOnly: true})).Set(float64(scheduler.nextNewVersions.Unix()))
+		}
+		sugar.Infof("next %s sync at %s", syncModeName(opts), nextRun.Format(time.RFC3339))
+		syncHealth.idle(nextRun)
+		sleepWithContext(ctx, time.Until(nextRun))
+		if ctx.Err() != nil {
+			sugar.Infof("shutting down")
+			return nil
+		}
+	}
+}
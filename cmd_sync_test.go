@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunSyncShutdownIsClean(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	err := os.WriteFile(configPath, []byte(`
+storage_type: fs
+fs_config:
+  download_root: `+filepath.Join(dir, "mirror")+`
+providers:
+  - reference: aws
+    version_range: ">=5.0.0"
+    os_archs:
+      - os: linux
+        arch: amd64
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+	}{
+		// the sync did not finish, so wrappers must not take it for a success
+		{"single run", nil, exitCodePartialFailure},
+		{"watch", []string{"--watch"}, exitCodeOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// as if SIGTERM arrived while the sync was running
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			err := runSync(ctx, &globalOptions{configPath: configPath, loggerType: "development"}, tt.args)
+			if code := exitCodeForError(err); code != tt.wantCode {
+				t.Errorf("exit code %d, want %d (error %v)", code, tt.wantCode, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// JSON Schema of the config file, for editor completion
+//
+//go:embed config.schema.json
+var configSchema []byte
+
+func runValidate(ctx context.Context, g *globalOptions, args []string) error {
+	fs := newCommandFlagSet(g, "validate", "validate [--schema]")
+	var schema bool
+	fs.BoolVar(&schema, "schema", false, "Print the JSON Schema of the config file instead of validating it")
+	err := parseCommandFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if schema {
+		_, err = os.Stdout.Write(configSchema)
+		return err
+	}
+
+	config, err := LoadConfig(g.configPath)
+	if err != nil {
+		// problems in a single file already start with its path
+		problems := strings.Split(err.Error(), "\n")
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		return &ConfigError{fmt.Errorf("found %d problems in %s", len(problems), g.configPath)}
+	}
+	fmt.Printf("%s is valid, %d providers\n", g.configPath, len(config.Providers))
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// keeps config.schema.json in step with the yaml tags of the config types
+func TestConfigSchemaMatchesConfigTypes(t *testing.T) {
+	type schemaNode struct {
+		Ref        string                `json:"$ref"`
+		Properties map[string]schemaNode `json:"properties"`
+		Items      *schemaNode           `json:"items"`
+	}
+	var schema struct {
+		schemaNode
+		Defs map[string]schemaNode `json:"$defs"`
+	}
+	err := json.Unmarshal(configSchema, &schema)
+	if err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+	resolve := func(node schemaNode) schemaNode {
+		if name, found := strings.CutPrefix(node.Ref, "#/$defs/"); found {
+			return schema.Defs[name]
+		}
+		return node
+	}
+	provider := schema.Defs["provider"]
+	notifications := schema.Properties["notifications"]
+
+	tests := []struct {
+		name   string
+		typ    reflect.Type
+		schema schemaNode
+	}{
+		{"top level", reflect.TypeFor[configRaw](), schema.schemaNode},
+		{"provider", reflect.TypeFor[ProviderMirrorConfiguration](), provider},
+		{"defaults", reflect.TypeFor[providerDefaults](), schema.Properties["defaults"]},
+		{"keep", reflect.TypeFor[versionPolicyConfig](), resolve(provider.Properties["keep"])},
+		{"retry", reflect.TypeFor[retryConfig](), resolve(provider.Properties["retry"])},
+		{"verification", reflect.TypeFor[verificationConfig](), resolve(provider.Properties["verification"])},
+		{"fs_config", reflect.TypeFor[fsConfig](), schema.Properties["fs_config"]},
+		{"s3_config", reflect.TypeFor[s3Config](), schema.Properties["s3_config"]},
+		{"notifications", reflect.TypeFor[notificationsConfig](), notifications},
+		{"webhook", reflect.TypeFor[webhookConfig](), *notifications.Properties["webhooks"].Items},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fields []string
+			for field := range tt.typ.Fields() {
+				tag, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+				if tag != "" && tag != "-" {
+					fields = append(fields, tag)
+				}
+			}
+			var properties []string
+			for property := range tt.schema.Properties {
+				properties = append(properties, property)
+			}
+			sort.Strings(fields)
+			sort.Strings(properties)
+			if !reflect.DeepEqual(fields, properties) {
+				t.Errorf("yaml fields %v, schema properties %v", fields, properties)
+			}
+		})
+	}
+}
+
+func TestRunValidate(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	err := os.WriteFile(configPath, []byte(`
+storage_type: fs
+fs_config:
+  download_root: /tmp/mirror
+providers:
+  - reference: aws
+    version_rnage: ">=5.0.0"
+    os_archs: [plan9_amd64]
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = runValidate(context.Background(), &globalOptions{configPath: configPath}, nil)
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		t.Fatalf("expected a ConfigError, got %v", err)
+	}
+	// the misspelt version_range also leaves the provider without a range
+	if !strings.Contains(err.Error(), "found 3 problems") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	err = os.WriteFile(configPath, []byte(`
+storage_type: fs
+fs_config:
+  download_root: /tmp/mirror
+providers:
+  - reference: aws
+    version_range: ">=5.0.0"
+    os_archs: [linux_amd64]
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = runValidate(context.Background(), &globalOptions{configPath: configPath}, nil)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+func runVerify(ctx context.Context, g *globalOptions, args []string) error {
+	fs := newCommandFlagSet(g, "verify", "verify [--provider REFERENCE]...")
+	var references stringSliceFlag
+	fs.Var(&references, "provider", "Only verify this provider (may be repeated)")
+	err := parseCommandFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	config, _, err := g.setup()
+	if err != nil {
+		return err
+	}
+	configProviders, err := selectProviders(ctx, config, references, true)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, configProvider := range configProviders {
+		provider, storage, catalog, err := loadConfiguredProviderCatalog(ctx, config, configProvider)
+		if err != nil {
+			sugar.Errorf("%v", err)
+			failed++
+			continue
+		}
+		valid, invalid, err := storage.VerifyCatalogAgainstStorage(catalog)
+		if err != nil {
+			sugar.Errorf("error verifying catalog against storage for provider %s: %v", provider, err)
+			failed++
+			continue
+		}
+
+		fmt.Printf("%s: %d valid, %d invalid\n", provider, len(valid), len(invalid))
+		for _, psib := range invalid {
+			fmt.Printf("  invalid: %s %s_%s (%s)\n", psib.Version, psib.OS, psib.Arch, psib.FullPath)
+		}
+		if len(invalid) > 0 {
+			syncNotifier.notify(ctx, config.Notifications, newIntegrityNotification(provider.String(), invalid))
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return &ProviderFailuresError{Failed: failed, Total: len(configProviders)}
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// one of the files that a config is split across
+type configFile struct {
+	// empty for a config that did not come from a file
+	path string
+	data []byte
+}
+
+// the top-level keys that can appear in any of the files; everything else is a setting that only one file can have
+var configFragmentKeys = []string{"providers", "include"}
+
+// reads the files that --config-path names: the file itself, the .yaml and .yml files in it if it is a directory,
+// or the files that match it if it is a glob, followed by the files that their include: entries pull in.
+// A file that is reached more than once is only read once.
+func readConfigFiles(configPath string) ([]configFile, error) {
+	paths, err := expandConfigPath(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%s does not match any config files", configPath)
+	}
+
+	var files []configFile
+	seen := make(map[string]bool)
+	add := func(paths []string) error {
+		for _, path := range paths {
+			absolute, err := filepath.Abs(path)
+			if err != nil {
+				return err
+			}
+			if seen[absolute] {
+				continue
+			}
+			seen[absolute] = true
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			files = append(files, configFile{path: path, data: data})
+		}
+		return nil
+	}
+	err = add(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	// files appended while looping are looked at as well, so included files can include others
+	for i := 0; i < len(files); i++ {
+		var includes struct {
+			Include []string `yaml:"include"`
+		}
+		// syntax errors are reported when the file is decoded properly
+		_ = yaml.Unmarshal(files[i].data, &includes)
+		for _, include := range includes.Include {
+			// interpolated like every other string in the config, before the path means anything
+			pattern, _, err := interpolateString(include)
+			if err != nil {
+				return nil, fmt.Errorf("%s: include %s: %w", files[i].path, include, err)
+			}
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(filepath.Dir(files[i].path), pattern)
+			}
+			paths, err := expandConfigPath(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%s: include %s: %w", files[i].path, include, err)
+			}
+			err = add(paths)
+			if err != nil {
+				return nil, fmt.Errorf("%s: include %s: %w", files[i].path, include, err)
+			}
+		}
+	}
+	return files, nil
+}
+
+// the config files a path stands for, in a stable order. A glob that matches nothing is not an error,
+// so that a directory that a team has not put anything in yet can be included.
+func expandConfigPath(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && strings.ContainsAny(path, "*?[") {
+			return filepath.Glob(path)
+		}
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		extension := filepath.Ext(entry.Name())
+		if entry.IsDir() || (extension != ".yaml" && extension != ".yml") {
+			continue
+		}
+		paths = append(paths, filepath.Join(path, entry.Name()))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// the contents of all the files a config is made of, so that a reload can tell whether anything changed
+func readConfigContents(configPath string) ([]byte, error) {
+	files, err := readConfigFiles(configPath)
+	if err != nil {
+		return nil, err
+	}
+	var contents bytes.Buffer
+	for _, file := range files {
+		fmt.Fprintf(&contents, "%s\x00%d\x00", file.path, len(file.data))
+		contents.Write(file.data)
+	}
+	return contents.Bytes(), nil
+}
+
+// strictly decodes one file. Errors are prefixed with the file's path.
+func decodeConfigFile(file configFile) (raw configRaw, settings []string, errs []error) {
+	prefix := ""
+	if file.path != "" {
+		prefix = file.path + ": "
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(file.data))
+	decoder.KnownFields(true)
+	err := decoder.Decode(&raw)
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		// the rest of the document is still decoded, so it can be checked as well
+		for _, message := range typeErr.Errors {
+			// yaml names the Go type the field was looked for in, which means nothing to the reader
+			message, _, _ = strings.Cut(message, " in type ")
+			errs = append(errs, errors.New(prefix+message))
+		}
+	} else if err != nil && !errors.Is(err, io.EOF) {
+		return raw, nil, []error{fmt.Errorf("%s%w", prefix, err)}
+	}
+
+	var topLevel map[string]yaml.Node
+	_ = yaml.Unmarshal(file.data, &topLevel)
+	for key := range topLevel {
+		if !StringInSlice(key, configFragmentKeys) {
+			settings = append(settings, key)
+		}
+	}
+	sort.Strings(settings)
+
+	for i := range raw.Providers {
+		raw.Providers[i].source = fmt.Sprintf("%sproviders[%d]", prefix, i)
+		for _, message := range raw.Providers[i].decodeErrors {
+			message, _, _ = strings.Cut(message, " in type ")
+			errs = append(errs, errors.New(prefix+message))
+		}
+	}
+	return raw, settings, errs
+}
+
+// the node a value was decoded from
+type yamlNodeCapture struct {
+	node *yaml.Node
+}
+
+func (c *yamlNodeCapture) UnmarshalYAML(node *yaml.Node) error {
+	c.node = node
+	return nil
+}
+
+// decodes a provider stanza and records which keys it sets. This is the older form of UnmarshalYAML, as only
+// that one decodes with the caller's decoder, which checks for unknown fields.
+func (c *ProviderMirrorConfiguration) UnmarshalYAML(unmarshal func(any) error) error {
+	type providerStanza ProviderMirrorConfiguration
+	err := unmarshal((*providerStanza)(c))
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		// kept with the stanza rather than returned, which would drop it from the list and leave the rest of it
+		// unchecked. The errors are copied, as yaml goes on to reuse their backing array.
+		c.decodeErrors = slices.Clone(typeErr.Errors)
+	} else if err != nil {
+		return err
+	}
+	var capture yamlNodeCapture
+	err = unmarshal(&capture)
+	if err != nil {
+		return err
+	}
+	c.set = make(map[string]bool)
+	for i := 0; i+1 < len(capture.node.Content); i += 2 {
+		c.set[capture.node.Content[i].Value] = true
+	}
+	return nil
+}
+
+// decodes every file and combines them into one. One file can have the storage and global settings,
+// the others can only add providers.
+func mergeConfigFiles(files []configFile) (merged configRaw, errs []error) {
+	settingsFile := ""
+	var providers []ProviderMirrorConfiguration
+	for _, file := range files {
+		raw, settings, fileErrs := decodeConfigFile(file)
+		errs = append(errs, fileErrs...)
+		if len(settings) > 0 {
+			if settingsFile != "" {
+				errs = append(errs, fmt.Errorf("%s has %s, but the settings are already in %s; files other than that one can only have providers and include", file.path, strings.Join(settings, ", "), settingsFile))
+				continue
+			}
+			settingsFile = file.path
+			merged = raw
+		}
+		providers = append(providers, raw.Providers...)
+	}
+	merged.Providers = providers
+	return merged, errs
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSettingsFile = `
+storage_type: fs
+fs_config:
+  download_root: /tmp/mirror
+providers:
+  - reference: aws
+    version_range: ">=5.0.0"
+`
+
+func writeConfigFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadConfigFromSeveralFiles(t *testing.T) {
+	tests := []struct {
+		name          string
+		files         map[string]string
+		configPath    string
+		wantProviders []string
+		wantErr       []string
+	}{
+		{
+			name: "directory",
+			files: map[string]string{
+				"conf.d/00-settings.yaml": testSettingsFile,
+				"conf.d/team-a.yaml":      "providers:\n  - reference: google\n    version_range: '>=5.0.0'\n",
+				"conf.d/team-b.yml":       "providers:\n  - reference: random\n    version_range: '>=3.0.0'\n",
+				"conf.d/README.md":        "not a config file",
+			},
+			configPath:    "conf.d",
+			wantProviders: []string{"aws", "google", "random"},
+		},
+		{
+			name: "glob",
+			files: map[string]string{
+				"settings.yaml":       testSettingsFile,
+				"teams/a/config.yaml": "providers:\n  - reference: google\n    version_range: '>=5.0.0'\n",
+			},
+			configPath:    "*.yaml",
+			wantProviders: []string{"aws"},
+		},
+		{
+			name: "include with globs, directories and a file included twice",
+			files: map[string]string{
+				"config.yaml":            testSettingsFile + "include: [teams/*/providers.yaml, shared, shared/random.yaml]\n",
+				"teams/a/providers.yaml": "providers:\n  - reference: google\n    version_range: '>=5.0.0'\n",
+				"teams/b/providers.yaml": "include: [../../more.yaml]\nproviders:\n  - reference: azurerm\n    version_range: '>=3.0.0'\n",
+				"shared/random.yaml":     "providers:\n  - reference: random\n    version_range: '>=3.0.0'\n",
+				"more.yaml":              "providers:\n  - reference: tls\n    version_range: '>=3.0.0'\n",
+			},
+			configPath:    "config.yaml",
+			wantProviders: []string{"aws", "google", "azurerm", "random", "tls"},
+		},
+		{
+			name: "settings in two files",
+			files: map[string]string{
+				"conf.d/a.yaml": testSettingsFile,
+				"conf.d/b.yaml": "strict: true\nproviders: []\n",
+			},
+			configPath: "conf.d",
+			wantErr:    []string{"b.yaml has strict, but the settings are already in", "a.yaml"},
+		},
+		{
+			name: "stanzas for the same provider in different files are merged",
+			files: map[string]string{
+				"conf.d/a.yaml": testSettingsFile,
+				"conf.d/b.yaml": "providers:\n  - reference: hashicorp/aws\n    version_range: '>=4.0.0 <5.0.0'\n",
+			},
+			configPath:    "conf.d",
+			wantProviders: []string{"aws"},
+		},
+		{
+			name: "stanzas for the same provider with conflicting settings",
+			files: map[string]string{
+				"conf.d/a.yaml": testSettingsFile,
+				"conf.d/b.yaml": "providers:\n  - reference: hashicorp/aws\n    version_range: '>=4.0.0'\n    min_age: 24h\n",
+			},
+			configPath: "conf.d",
+			wantErr:    []string{"provider registry.terraform.io/hashicorp/aws is declared in", "a.yaml: providers[0] and again in", "b.yaml: providers[0]", "different min_age (0s and 24h0m0s)"},
+		},
+		{
+			name: "unknown field in an included file",
+			files: map[string]string{
+				"config.yaml": testSettingsFile + "include: [team.yaml]\n",
+				"team.yaml":   "providers:\n  - reference: google\n    version_rnage: '>=5.0.0'\n",
+			},
+			configPath: "config.yaml",
+			wantErr:    []string{"team.yaml: line 3: field version_rnage not found"},
+		},
+		{
+			name: "missing include",
+			files: map[string]string{
+				"config.yaml": testSettingsFile + "include: [team.yaml]\n",
+			},
+			configPath: "config.yaml",
+			wantErr:    []string{"include", "team.yaml"},
+		},
+		{
+			name: "include from an environment variable",
+			files: map[string]string{
+				"config.yaml":                       testSettingsFile + "include: ['${TFSPIEGEL_TEST_TEAMS}/*.yaml']\n",
+				"teams/team.yaml":                   "providers:\n  - reference: google\n    version_range: '>=5.0.0'\n",
+				"${TFSPIEGEL_TEST_TEAMS}/team.yaml": "providers:\n  - reference: random\n    version_range: '>=3.0.0'\n",
+			},
+			configPath:    "config.yaml",
+			wantProviders: []string{"aws", "google"},
+		},
+		{
+			name: "include from an unset environment variable",
+			files: map[string]string{
+				"config.yaml": testSettingsFile + "include: ['${TFSPIEGEL_TEST_UNSET}/*.yaml']\n",
+			},
+			configPath: "config.yaml",
+			wantErr:    []string{"include ${TFSPIEGEL_TEST_UNSET}/*.yaml", "TFSPIEGEL_TEST_UNSET is not set"},
+		},
+		{
+			name:       "glob without matches",
+			files:      map[string]string{},
+			configPath: "*.yaml",
+			wantErr:    []string{"does not match any config files"},
+		},
+	}
+
+	t.Setenv("TFSPIEGEL_TEST_TEAMS", "teams")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeConfigFiles(t, dir, tt.files)
+
+			config, err := LoadConfig(filepath.Join(dir, tt.configPath))
+			if tt.wantErr != nil {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				for _, want := range tt.wantErr {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("error does not mention %q:\n%v", want, err)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []string
+			for _, provider := range config.Providers {
+				got = append(got, provider.Reference)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.wantProviders, " ") {
+				t.Errorf("got providers %v, want %v", got, tt.wantProviders)
+			}
+		})
+	}
+}
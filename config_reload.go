@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// holds the configuration for a long-running sync and swaps it out when the file changes or on SIGHUP;
+// a new configuration that fails to load or validate is logged and the previous one is kept
+type configReloader struct {
+	path string
+
+	mu       sync.Mutex
+	current  Configuration
+	contents []byte
+}
+
+func newConfigReloader(path string, initial Configuration) *configReloader {
+	// the contents are only used to tell whether the file really changed, so a read error here just means
+	// that the first event will cause a reload
+	contents, _ := readConfigContents(path)
+	return &configReloader{
+		path:     path,
+		current:  initial,
+		contents: contents,
+	}
+}
+
+// the configuration that the next sync should use
+func (r *configReloader) Current() Configuration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// loads the file again if its contents have changed since the last load
+func (r *configReloader) reload() {
+	contents, err := readConfigContents(r.path)
+	if err != nil {
+		sugar.Errorf("unable to read config files %s, keeping current config: %v", r.path, err)
+		metricConfigReloads.WithLabelValues("failure").Inc()
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if bytes.Equal(contents, r.contents) {
+		return
+	}
+
+	config, err := LoadConfig(r.path)
+	if err != nil {
+		sugar.Errorf("new config in %s is invalid, keeping current config: %v", r.path, err)
+		metricConfigReloads.WithLabelValues("failure").Inc()
+		// remember the broken contents so the same error is not logged for every unrelated event
+		r.contents = contents
+		return
+	}
+	r.current = config
+	r.contents = contents
+	metricConfigReloads.WithLabelValues("success").Inc()
+	sugar.Infof("reloaded config from %s, %d providers will be used from the next sync", r.path, len(config.Providers))
+}
+
+// watches the config files and SIGHUP until ctx is cancelled. The directories are watched rather than the files
+// themselves, because editors and Kubernetes ConfigMap updates replace a file (or a symlink above it) instead
+// of writing to it, which a watch on the file would not survive.
+func (r *configReloader) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	for _, dir := range configWatchDirs(r.path) {
+		err = watcher.Add(dir)
+		if err != nil {
+			_ = watcher.Close()
+			return err
+		}
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		defer func() { _ = watcher.Close() }()
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				sugar.Infof("got SIGHUP, reloading config")
+				// a SIGHUP always reloads, even if the contents look the same
+				r.mu.Lock()
+				r.contents = nil
+				r.mu.Unlock()
+				r.reload()
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				sugar.Debugf("config directory event: %s", event)
+				r.reload()
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				sugar.Errorf("error watching config file %s: %v", r.path, err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// the directories that hold the config files when watching starts. A directory given as the config path is
+// watched itself so that files added to it are noticed.
+func configWatchDirs(configPath string) []string {
+	var dirs []string
+	if info, err := os.Stat(configPath); err == nil && info.IsDir() {
+		dirs = append(dirs, configPath)
+	} else if !strings.ContainsAny(configPath, "*?[") {
+		dirs = append(dirs, filepath.Dir(configPath))
+	}
+	files, _ := readConfigFiles(configPath)
+	for _, file := range files {
+		dir := filepath.Dir(file.path)
+		if !StringInSlice(dir, dirs) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func writeReloadTestConfig(t *testing.T, path, root string) {
+	t.Helper()
+	contents := []byte(`
+storage_type: fs
+fs_config:
+  download_root: ` + root + `
+providers:
+  - reference: aws
+    version_range: ">=5.0.0"
+`)
+	if err := os.WriteFile(path, contents, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigReloaderReload(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		wantRoot string
+		result   string
+	}{
+		{
+			name: "valid config is picked up",
+			contents: `
+storage_type: fs
+fs_config:
+  download_root: /new
+providers:
+  - reference: aws
+    version_range: ">=5.0.0"
+`,
+			wantRoot: "/new",
+			result:   "success",
+		},
+		{
+			name: "invalid version range keeps the old config",
+			contents: `
+storage_type: fs
+fs_config:
+  download_root: /new
+providers:
+  - reference: aws
+    version_range: "not a range"
+`,
+			wantRoot: "/old",
+			result:   "failure",
+		},
+		{
+			name:     "unparseable yaml keeps the old config",
+			contents: "providers: [",
+			wantRoot: "/old",
+			result:   "failure",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			writeReloadTestConfig(t, path, "/old")
+			initial, err := LoadConfig(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := newConfigReloader(path, initial)
+
+			if err := os.WriteFile(path, []byte(tt.contents), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			before := testutil.ToFloat64(metricConfigReloads.WithLabelValues(tt.result))
+			r.reload()
+
+			if got := r.Current().DownloadDestination.FSConfig.DownloadRoot; got != tt.wantRoot {
+				t.Errorf("download root = %q, want %q", got, tt.wantRoot)
+			}
+			if got := testutil.ToFloat64(metricConfigReloads.WithLabelValues(tt.result)); got != before+1 {
+				t.Errorf("%s reloads = %v, want %v", tt.result, got, before+1)
+			}
+		})
+	}
+}
+
+func TestConfigReloaderUnchangedContents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeReloadTestConfig(t, path, "/old")
+	initial, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newConfigReloader(path, initial)
+
+	before := testutil.ToFloat64(metricConfigReloads.WithLabelValues("success"))
+	r.reload()
+	if got := testutil.ToFloat64(metricConfigReloads.WithLabelValues("success")); got != before {
+		t.Errorf("reload of unchanged file was counted")
+	}
+}
+
+// mimics how Kubernetes updates a mounted ConfigMap: the file is a symlink into a directory that is
+// swapped out by renaming a new ..data symlink over the old one
+func TestConfigReloaderWatchSymlinkSwap(t *testing.T) {
+	dir := t.TempDir()
+	for _, version := range []string{"v1", "v2"} {
+		if err := os.Mkdir(filepath.Join(dir, version), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		writeReloadTestConfig(t, filepath.Join(dir, version, "config.yaml"), "/"+version)
+	}
+	if err := os.Symlink("v1", filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.Symlink(filepath.Join("..data", "config.yaml"), path); err != nil {
+		t.Fatal(err)
+	}
+
+	initial, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newConfigReloader(path, initial)
+	if err := r.Watch(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink("v2", filepath.Join(dir, "..data_tmp")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for r.Current().DownloadDestination.FSConfig.DownloadRoot != "/v2" {
+		if time.Now().After(deadline) {
+			t.Fatalf("config was not reloaded after the symlink swap")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConfigReloaderDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeReloadTestConfig(t, filepath.Join(dir, "settings.yaml"), "/mirror")
+	initial, err := LoadConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newConfigReloader(dir, initial)
+
+	err = os.WriteFile(filepath.Join(dir, "team.yaml"), []byte("providers:\n  - reference: google\n    version_range: '>=5.0.0'\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.reload()
+	if got := len(r.Current().Providers); got != 2 {
+		t.Errorf("got %d providers after adding a file, want 2", got)
+	}
+	if dirs := configWatchDirs(dir); len(dirs) != 1 || dirs[0] != dir {
+		t.Errorf("unexpected watched directories %v", dirs)
+	}
+}
@@ -1,8 +1,71 @@
 package main
 
+import "time"
+
 const (
 	defaultProviderHostname = "registry.terraform.io"
 	defaultProviderOwner    = "hashicorp"
 	mirrorIndexFile         = "index.json"
 	s3EtagMapFile           = ".etag-map.json"
+	catalogMetadataFile     = ".catalog-metadata.json"
+	firstSeenFile           = ".first-seen.json"
+	serviceDiscoveryPath    = "/.well-known/terraform.json"
+	defaultProvidersAPIPath = "/v1/providers/"
+)
+
+// layouts of filesystem storage; packed is the same as network_mirror, whose zips are laid out the way
+// Terraform's filesystem_mirror expects and whose JSON files filesystem_mirror ignores
+const (
+	fsLayoutNetworkMirror = "network_mirror"
+	fsLayoutPacked        = "packed"
+	fsLayoutUnpacked      = "unpacked"
+)
+
+// downloads of an instance are attempted this many times, waiting n*n times the backoff before retry n
+const (
+	defaultRetryMaxAttempts = 5
+	defaultRetryBackoff     = time.Second
+)
+
+// verification policies for what is already in storage
+const (
+	verifyStorageFull    = "full"
+	verifyStorageCatalog = "catalog"
+)
+
+// types of upstreams that providers can be mirrored from besides their registry
+const (
+	upstreamTypeNetworkMirror = "network_mirror"
+)
+
+// how long a host whose service discovery failed is assumed to serve the registry API at /v1/providers/ before
+// discovery is tried again
+const discoveryFallbackTTL = 10 * time.Minute
+
+// download info and publish dates of a version do not change, so they are reused for this long without asking
+// the registry again; the bound is there for registries that hand out download URLs which expire
+const defaultDownloadInfoTTL = 24 * time.Hour
+
+// the most registry responses kept in memory; the disk cache, if there is one, still has the rest
+const registryCacheMaxEntries = 1000
+
+// cache files that have not been used for this long are removed from the disk cache
+const registryCacheMaxIdle = 30 * 24 * time.Hour
+
+// how long uploads and catalog writes get to finish after a shutdown signal, kept below the
+// 30 second default termination grace period of Kubernetes
+const storageShutdownGracePeriod = 25 * time.Second
+
+const (
+	defaultNotificationRepeatInterval = 24 * time.Hour
+	notificationTimeout               = 10 * time.Second
+)
+
+// process exit codes, documented in the README
+const (
+	exitCodeOK             = 0
+	exitCodeTotalFailure   = 1
+	exitCodeUsage          = 2
+	exitCodeConfig         = 3
+	exitCodePartialFailure = 4
 )
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/hcl"
+)
+
+// the parts of a Terraform CLI configuration file (.terraformrc or credentials.tfrc.json) that tfspiegel uses
+type cliConfigFile struct {
+	Credentials map[string]map[string]any `hcl:"credentials" json:"credentials"`
+}
+
+// returns the API token for a registry host, looking in the credentials block of the config first, then at the
+// TF_TOKEN_<host> environment variable and finally at the credentials blocks of the Terraform CLI configuration
+func (c Configuration) registryToken(hostname string) string {
+	hostname = strings.ToLower(hostname)
+	for configured, credentials := range c.Credentials {
+		if strings.ToLower(configured) == hostname && credentials.Token != "" {
+			return credentials.Token
+		}
+	}
+	if token := os.Getenv(tokenEnvVarName(hostname)); token != "" {
+		return token
+	}
+	return cliConfigTokens()[hostname]
+}
+
+// the environment variable Terraform reads a host's token from: dots become underscores and hyphens double underscores
+func tokenEnvVarName(hostname string) string {
+	return "TF_TOKEN_" + strings.NewReplacer(".", "_", "-", "__").Replace(hostname)
+}
+
+// the CLI configuration only changes when someone logs in, so it is read once per process
+var cliConfigTokens = sync.OnceValue(func() map[string]string {
+	tokens := map[string]string{}
+	// later files win, which matches Terraform preferring credentials.tfrc.json over the CLI config file
+	for _, path := range cliConfigPaths() {
+		err := readCLIConfigTokens(path, tokens)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			sugar.Warnf("ignoring credentials in %s: %v", path, err)
+		}
+	}
+	return tokens
+})
+
+func cliConfigPaths() []string {
+	var paths []string
+	if path := os.Getenv("TF_CLI_CONFIG_FILE"); path != "" {
+		paths = append(paths, path)
+	} else if runtime.GOOS == "windows" {
+		paths = append(paths, filepath.Join(os.Getenv("APPDATA"), "terraform.rc"))
+	} else if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".terraformrc"), filepath.Join(home, ".tofurc"))
+	}
+
+	configDir := ""
+	if runtime.GOOS == "windows" {
+		configDir = filepath.Join(os.Getenv("APPDATA"), "terraform.d")
+	} else if home, err := os.UserHomeDir(); err == nil {
+		configDir = filepath.Join(home, ".terraform.d")
+	}
+	if configDir != "" {
+		paths = append(paths, filepath.Join(configDir, "credentials.tfrc.json"))
+	}
+	return paths
+}
+
+func readCLIConfigTokens(path string, tokens map[string]string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var config cliConfigFile
+	if strings.HasSuffix(path, ".json") {
+		err = json.Unmarshal(data, &config)
+	} else {
+		err = hcl.Unmarshal(data, &config)
+	}
+	if err != nil {
+		return err
+	}
+
+	for hostname, block := range config.Credentials {
+		if token, ok := block["token"].(string); ok && token != "" {
+			tokens[strings.ToLower(hostname)] = token
+		}
+	}
+	return nil
+}
+
+// adds the registry token to a request for the registry API
+func authorizeRegistryRequest(req *http.Request, token string) {
+	if token == "" {
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+}
+
+// download URLs often point at a CDN or GitHub, which must never see the registry token
+func sameHost(u *url.URL, hostname string) bool {
+	return strings.EqualFold(u.Host, hostname)
+}
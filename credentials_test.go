@@ -0,0 +1,193 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestTokenEnvVarName(t *testing.T) {
+	tests := []struct {
+		hostname string
+		want     string
+	}{
+		{"app.terraform.io", "TF_TOKEN_app_terraform_io"},
+		{"tf-registry.example.com", "TF_TOKEN_tf__registry_example_com"},
+	}
+	for _, tt := range tests {
+		if got := tokenEnvVarName(tt.hostname); got != tt.want {
+			t.Errorf("tokenEnvVarName(%q) = %q, want %q", tt.hostname, got, tt.want)
+		}
+	}
+}
+
+func TestReadCLIConfigTokens(t *testing.T) {
+	dir := t.TempDir()
+	rc := filepath.Join(dir, ".terraformrc")
+	err := os.WriteFile(rc, []byte(`
+plugin_cache_dir = "/tmp/plugins"
+
+credentials "App.Terraform.io" {
+  token = "from-rc"
+}
+
+credentials "registry.example.com" {
+  token = "other"
+}
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonFile := filepath.Join(dir, "credentials.tfrc.json")
+	err = os.WriteFile(jsonFile, []byte(`{"credentials": {"app.terraform.io": {"token": "from-json"}}}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := map[string]string{}
+	for _, path := range []string{rc, jsonFile} {
+		if err := readCLIConfigTokens(path, tokens); err != nil {
+			t.Fatalf("readCLIConfigTokens(%s): %v", path, err)
+		}
+	}
+
+	want := map[string]string{"app.terraform.io": "from-json", "registry.example.com": "other"}
+	if len(tokens) != len(want) {
+		t.Fatalf("tokens = %v, want %v", tokens, want)
+	}
+	for hostname, token := range want {
+		if tokens[hostname] != token {
+			t.Errorf("token for %s = %q, want %q", hostname, tokens[hostname], token)
+		}
+	}
+}
+
+func TestRegistryToken(t *testing.T) {
+	const hostname = "app.example.com"
+	tests := []struct {
+		name   string
+		config string
+		env    string
+		cli    string
+		want   string
+	}{
+		{"config over environment and CLI config", "config", "env", "cli", "config"},
+		// as in Terraform, the environment variable overrides the CLI config file
+		{"environment over CLI config", "", "env", "cli", "env"},
+		{"CLI config", "", "", "cli", "cli"},
+		{"none", "", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldTokens := cliConfigTokens
+			cliConfigTokens = func() map[string]string {
+				if tt.cli == "" {
+					return map[string]string{}
+				}
+				return map[string]string{hostname: tt.cli}
+			}
+			defer func() { cliConfigTokens = oldTokens }()
+			t.Setenv(tokenEnvVarName(hostname), tt.env)
+
+			config := Configuration{}
+			if tt.config != "" {
+				// hostnames are matched without regard to case
+				config.Credentials = map[string]registryCredentialsConfig{"APP.example.com": {Token: tt.config}}
+			}
+			if got := config.registryToken(hostname); got != tt.want {
+				t.Errorf("registryToken(%q) = %q, want %q", hostname, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMirrorProviderInstanceToDestSendsToken(t *testing.T) {
+	origClient := httpClient
+	defer func() { httpClient = origClient }()
+
+	testBinary := []byte("private provider")
+	testSHA := fmt.Sprintf("%x", sha256.Sum256(testBinary))
+
+	var mu sync.Mutex
+	auth := map[string]string{}
+	record := func(r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		auth[r.Host+r.URL.Path] = r.Header.Get("Authorization")
+	}
+
+	cdn := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		_, _ = w.Write(testBinary)
+	}))
+	defer cdn.Close()
+
+	for _, tt := range []struct {
+		name       string
+		sameHost   bool
+		wantOnFile string
+	}{
+		{"download on the registry host", true, "Bearer secret"},
+		{"download on another host", false, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				record(r)
+				switch r.URL.Path {
+				case "/v1/providers/corp/internal/1.0.0/download/linux/amd64":
+					downloadHost := cdn.URL
+					if tt.sameHost {
+						downloadHost = "https://" + r.Host
+					}
+					_ = json.NewEncoder(w).Encode(HCTFRegistryDownloadResponse{
+						DownloadURL: downloadHost + "/files/internal.zip",
+						Shasum:      testSHA,
+					})
+				case "/files/internal.zip":
+					_, _ = w.Write(testBinary)
+				default:
+					w.WriteHeader(404)
+				}
+			}))
+			defer registry.Close()
+			httpClient = registry.Client()
+
+			registryHost := registry.URL[len("https://"):]
+			pi := ProviderSpecificInstance{
+				Provider: Provider{Hostname: registryHost, Owner: "corp", Name: "internal"},
+				Version:  "1.0.0",
+				OS:       "linux",
+				Arch:     "amd64",
+			}
+			mock := mockProviderStorer{
+				writeProviderBinaryDataToStorageFunc: func(data []byte, p ProviderSpecificInstance) (*ProviderSpecificInstanceBinary, error) {
+					return &ProviderSpecificInstanceBinary{ProviderSpecificInstance: p}, nil
+				},
+			}
+
+			d := ProviderDownloader{Storage: mock, Source: registrySource{token: "secret"}}
+			if _, err := d.MirrorProviderInstanceToDest(t.Context(), pi); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if got := auth[registryHost+"/v1/providers/corp/internal/1.0.0/download/linux/amd64"]; got != "Bearer secret" {
+				t.Errorf("download info request Authorization = %q, want the token", got)
+			}
+			fileHost := cdn.URL[len("https://"):]
+			if tt.sameHost {
+				fileHost = registryHost
+			}
+			if got := auth[fileHost+"/files/internal.zip"]; got != tt.wantOnFile {
+				t.Errorf("download request Authorization = %q, want %q", got, tt.wantOnFile)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// settings that apply to every provider stanza that does not set them itself
+type providerDefaults struct {
+	OSArchs            []HCTFProviderPlatform `json:"os_archs,omitempty" yaml:"os_archs,omitempty"`
+	Keep               versionPolicyConfig    `json:"keep,omitempty" yaml:"keep,omitempty"`
+	MinAge             time.Duration          `json:"min_age,omitempty" yaml:"min_age,omitempty"`
+	IncludePrereleases bool                   `json:"include_prereleases,omitempty" yaml:"include_prereleases,omitempty"`
+	Retry              retryConfig            `json:"retry,omitempty" yaml:"retry,omitempty"`
+	Verification       verificationConfig     `json:"verification,omitempty" yaml:"verification,omitempty"`
+}
+
+// how often and how patiently an instance is downloaded before it counts as failed
+type retryConfig struct {
+	// attempts per instance, defaults to defaultRetryMaxAttempts
+	MaxAttempts int `json:"max_attempts,omitempty" yaml:"max_attempts,omitempty"`
+	// the wait before retry n is n*n times this, defaults to defaultRetryBackoff
+	Backoff time.Duration `json:"backoff,omitempty" yaml:"backoff,omitempty"`
+}
+
+func (c retryConfig) maxAttempts() int {
+	if c.MaxAttempts > 0 {
+		return c.MaxAttempts
+	}
+	return defaultRetryMaxAttempts
+}
+
+func (c retryConfig) backoff() time.Duration {
+	if c.Backoff > 0 {
+		return c.Backoff
+	}
+	return defaultRetryBackoff
+}
+
+// how much of what is mirrored and downloaded gets checked
+type verificationConfig struct {
+	// full (the default) hashes everything in storage on each full sync, catalog trusts the catalog like --new-versions-only
+	Storage string `json:"storage,omitempty" yaml:"storage,omitempty"`
+	// fail downloads that upstream gives no checksum or hashes for, instead of mirroring them with a warning
+	RequireHashes bool `json:"require_hashes,omitempty" yaml:"require_hashes,omitempty"`
+}
+
+func (c verificationConfig) validate() error {
+	switch c.Storage {
+	case "", verifyStorageFull, verifyStorageCatalog:
+		return nil
+	}
+	return fmt.Errorf("verification storage %q is not one of %s or %s", c.Storage, verifyStorageFull, verifyStorageCatalog)
+}
+
+// fills in the settings that a provider stanza leaves out from defaults. A setting counts as left out when its key
+// is missing from the stanza, so that a stanza can replace a default with an empty or zero value; blocks such as
+// keep and retry replace the default block as a whole.
+func applyProviderDefaults(providers []ProviderMirrorConfiguration, defaults providerDefaults) {
+	for i := range providers {
+		p := &providers[i]
+		isSet := func(key string) bool {
+			return p.set[key]
+		}
+		if !isSet("os_archs") {
+			p.OSArchs = defaults.OSArchs
+		}
+		if !isSet("keep") {
+			p.Keep = defaults.Keep
+		}
+		if !isSet("min_age") {
+			p.MinAge = defaults.MinAge
+		}
+		if !isSet("include_prereleases") {
+			p.IncludePrereleases = defaults.IncludePrereleases
+		}
+		if !isSet("retry") {
+			p.Retry = defaults.Retry
+		}
+		if !isSet("verification") {
+			p.Verification = defaults.Verification
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestApplyProviderDefaults(t *testing.T) {
+	data := `
+providers:
+  - reference: aws
+  - reference: random
+    os_archs: [linux_amd64]
+    min_age: 0s
+    keep: {}
+  - reference: "null"
+    retry: {max_attempts: 2}
+`
+	var raw struct {
+		Providers []ProviderMirrorConfiguration `yaml:"providers"`
+	}
+	if err := yaml.Unmarshal([]byte(data), &raw); err != nil {
+		t.Fatal(err)
+	}
+
+	defaults := providerDefaults{
+		OSArchs:      []HCTFProviderPlatform{{OS: "darwin", Arch: "arm64"}},
+		Keep:         versionPolicyConfig{Latest: 3},
+		MinAge:       72 * time.Hour,
+		Retry:        retryConfig{MaxAttempts: 10, Backoff: time.Minute},
+		Verification: verificationConfig{Storage: verifyStorageCatalog},
+	}
+	applyProviderDefaults(raw.Providers, defaults)
+
+	aws, random, null := raw.Providers[0], raw.Providers[1], raw.Providers[2]
+	if !reflect.DeepEqual(aws.OSArchs, defaults.OSArchs) || aws.Keep != defaults.Keep || aws.MinAge != defaults.MinAge || aws.Verification != defaults.Verification {
+		t.Errorf("defaults not applied to a stanza without settings: %+v", aws)
+	}
+	if !reflect.DeepEqual(random.OSArchs, []HCTFProviderPlatform{{OS: "linux", Arch: "amd64"}}) {
+		t.Errorf("os_archs of the stanza was replaced: %+v", random.OSArchs)
+	}
+	if random.MinAge != 0 || random.Keep.isSet() {
+		t.Errorf("explicit zero values were replaced by defaults: min_age %s, keep %+v", random.MinAge, random.Keep)
+	}
+	if null.Retry != (retryConfig{MaxAttempts: 2}) {
+		t.Errorf("retry block should replace the default as a whole, got %+v", null.Retry)
+	}
+}
+
+func TestApplyProviderDefaultsAfterBadStanza(t *testing.T) {
+	config, err := parseConfig([]byte(`
+storage_type: fs
+fs_config:
+  download_root: /mirror
+defaults:
+  os_archs: [linux_amd64]
+  min_age: 72h
+providers:
+  - reference: aws
+    version_range: ">=5.0.0"
+  - not a stanza
+  - reference: google
+    version_range: [">=5.0.0"]
+  - reference: random
+    version_range: ">=3.0.0"
+    os_archs: [darwin_arm64]
+    min_age: 0s
+`))
+	for _, want := range []string{"line 11: cannot unmarshal", "provider 1 has no reference", "line 13: cannot unmarshal !!seq"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q:\n%v", want, err)
+		}
+	}
+
+	// each stanza keeps its own settings, whatever is wrong with the ones before it
+	references := map[string]ProviderMirrorConfiguration{}
+	for _, configProvider := range config.Providers {
+		references[configProvider.Reference] = configProvider
+	}
+	aws, google, random := references["aws"], references["google"], references["random"]
+	if aws.MinAge != 72*time.Hour || !reflect.DeepEqual(aws.OSArchs, []HCTFProviderPlatform{{OS: "linux", Arch: "amd64"}}) {
+		t.Errorf("aws did not get the defaults: %+v", aws)
+	}
+	if google.MinAge != 72*time.Hour || google.source != "providers[2]" {
+		t.Errorf("google did not get the defaults or has the wrong source: %+v", google)
+	}
+	if random.MinAge != 0 || !reflect.DeepEqual(random.OSArchs, []HCTFProviderPlatform{{OS: "darwin", Arch: "arm64"}}) {
+		t.Errorf("random's own settings were replaced by defaults: %+v", random)
+	}
+}
+
+func TestRetryConfigDefaults(t *testing.T) {
+	var c retryConfig
+	if c.maxAttempts() != defaultRetryMaxAttempts || c.backoff() != defaultRetryBackoff {
+		t.Errorf("zero retry config = %d attempts and %s backoff", c.maxAttempts(), c.backoff())
+	}
+	c = retryConfig{MaxAttempts: 2, Backoff: time.Minute}
+	if c.maxAttempts() != 2 || c.backoff() != time.Minute {
+		t.Errorf("retry config = %d attempts and %s backoff", c.maxAttempts(), c.backoff())
+	}
+}
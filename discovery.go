@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the document that a registry host publishes to say where its APIs live, see
+// https://developer.hashicorp.com/terraform/internals/remote-service-discovery
+type serviceDiscoveryDocument struct {
+	ProvidersV1 string `json:"providers.v1"`
+}
+
+// successful lookups are kept for the life of the process. Failures fall back to the conventional path, which is
+// kept for discoveryFallbackTTL so that a host without a discovery document is not asked on every request, while
+// a host that was only unreachable for a while is asked again later.
+var discoveredProvidersAPIs = struct {
+	sync.Mutex
+	bases map[string]discoveredProvidersAPI
+}{bases: map[string]discoveredProvidersAPI{}}
+
+type discoveredProvidersAPI struct {
+	base string
+	// zero for bases that were discovered
+	expires time.Time
+}
+
+// returns the base URL of the provider registry API on hostname, ending in a slash. Hosts that do not
+// answer service discovery get the conventional /v1/providers/, which is where both registry.terraform.io
+// and registry.opentofu.org serve it.
+func providersAPIBase(ctx context.Context, hostname string, token string) string {
+	discoveredProvidersAPIs.Lock()
+	discovered, ok := discoveredProvidersAPIs.bases[hostname]
+	discoveredProvidersAPIs.Unlock()
+	if ok && (discovered.expires.IsZero() || time.Now().Before(discovered.expires)) {
+		return discovered.base
+	}
+
+	base, err := discoverProvidersAPI(ctx, hostname, token)
+	if err != nil {
+		sugar.Debugf("service discovery for %s failed, using %s: %v", hostname, defaultProvidersAPIPath, err)
+		discovered = discoveredProvidersAPI{
+			base:    "https://" + hostname + defaultProvidersAPIPath,
+			expires: time.Now().Add(discoveryFallbackTTL),
+		}
+		// a lookup cut short by a shutdown says nothing about the host
+		if ctx.Err() == nil {
+			discoveredProvidersAPIs.Lock()
+			discoveredProvidersAPIs.bases[hostname] = discovered
+			discoveredProvidersAPIs.Unlock()
+		}
+		return discovered.base
+	}
+
+	discoveredProvidersAPIs.Lock()
+	discoveredProvidersAPIs.bases[hostname] = discoveredProvidersAPI{base: base}
+	discoveredProvidersAPIs.Unlock()
+	return base
+}
+
+func discoverProvidersAPI(ctx context.Context, hostname string, token string) (string, error) {
+	discoveryURL, err := url.Parse("https://" + hostname + serviceDiscoveryPath)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	authorizeRegistryRequest(req, token)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP %d from %s", resp.StatusCode, discoveryURL)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	var document serviceDiscoveryDocument
+	err = json.Unmarshal(body, &document)
+	if err != nil {
+		return "", fmt.Errorf("error unmarshalling service discovery document: %w", err)
+	}
+	if document.ProvidersV1 == "" {
+		return "", fmt.Errorf("%s does not offer providers.v1", hostname)
+	}
+
+	// the location may be relative to the discovery document or an absolute URL on another host
+	providersURL, err := discoveryURL.Parse(document.ProvidersV1)
+	if err != nil {
+		return "", fmt.Errorf("invalid providers.v1 location %q: %w", document.ProvidersV1, err)
+	}
+	base := providersURL.String()
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	return base, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestProvidersAPIBase(t *testing.T) {
+	tests := []struct {
+		name      string
+		discovery func(host string) (int, string)
+		wantPath  string
+	}{
+		{
+			name:      "relative location",
+			discovery: func(string) (int, string) { return 200, `{"providers.v1": "/api/registry/v1/providers"}` },
+			wantPath:  "/api/registry/v1/providers/",
+		},
+		{
+			name: "absolute location",
+			discovery: func(host string) (int, string) {
+				return 200, fmt.Sprintf(`{"modules.v1": "/v1/modules/", "providers.v1": "https://%s/other/"}`, host)
+			},
+			wantPath: "/other/",
+		},
+		{
+			name:      "no discovery document",
+			discovery: func(string) (int, string) { return 404, "" },
+			wantPath:  defaultProvidersAPIPath,
+		},
+		{
+			name:      "host without providers",
+			discovery: func(string) (int, string) { return 200, `{"modules.v1": "/v1/modules/"}` },
+			wantPath:  defaultProvidersAPIPath,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discoveryRequests := 0
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case serviceDiscoveryPath:
+					discoveryRequests++
+					status, body := tt.discovery(r.Host)
+					w.WriteHeader(status)
+					_, _ = fmt.Fprint(w, body)
+				case tt.wantPath + "hashicorp/aws/versions":
+					_, _ = fmt.Fprint(w, `{"versions": [{"version": "5.0.0", "platforms": [{"os": "linux", "arch": "amd64"}]}]}`)
+				default:
+					w.WriteHeader(404)
+				}
+			}))
+			defer server.Close()
+
+			oldClient := httpClient
+			httpClient = server.Client()
+			defer func() { httpClient = oldClient }()
+
+			serverHost := server.URL[len("https://"):]
+			want := "https://" + serverHost + tt.wantPath
+			if got := providersAPIBase(t.Context(), serverHost, ""); got != want {
+				t.Errorf("providersAPIBase() = %q, want %q", got, want)
+			}
+
+			p := Provider{Hostname: serverHost, Owner: "hashicorp", Name: "aws"}
+			metadata, err := p.GetProviderMetadataFromRegistry(t.Context(), "")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(metadata.Versions) != 1 {
+				t.Errorf("got %d versions, want 1", len(metadata.Versions))
+			}
+			// the fallback is cached as well as what was discovered
+			if discoveryRequests != 1 {
+				t.Errorf("got %d discovery requests, want 1", discoveryRequests)
+			}
+
+			// once the fallback expires the host is asked again, a discovered base is kept
+			discoveredProvidersAPIs.Lock()
+			discovered := discoveredProvidersAPIs.bases[serverHost]
+			if !discovered.expires.IsZero() {
+				discovered.expires = time.Now().Add(-time.Second)
+				discoveredProvidersAPIs.bases[serverHost] = discovered
+			}
+			discoveredProvidersAPIs.Unlock()
+			wantRequests := 1
+			if tt.wantPath == defaultProvidersAPIPath {
+				wantRequests = 2
+			}
+			if got := providersAPIBase(t.Context(), serverHost, ""); got != want || discoveryRequests != wantRequests {
+				t.Errorf("providersAPIBase() = %q after %d discovery requests, want %q after %d", got, discoveryRequests, want, wantRequests)
+			}
+		})
+	}
+}
+
+func TestConfigurationNewProvider(t *testing.T) {
+	tests := []struct {
+		name     string
+		hostname string
+		input    string
+		want     Provider
+	}{
+		{"default registry", "", "aws", Provider{Hostname: "registry.terraform.io", Owner: "hashicorp", Name: "aws"}},
+		{"overridden registry", "registry.opentofu.org", "aws", Provider{Hostname: "registry.opentofu.org", Owner: "hashicorp", Name: "aws"}},
+		{"overridden registry with owner", "registry.opentofu.org", "integrations/github", Provider{Hostname: "registry.opentofu.org", Owner: "integrations", Name: "github"}},
+		{"explicit hostname wins", "registry.opentofu.org", "registry.terraform.io/hashicorp/aws", Provider{Hostname: "registry.terraform.io", Owner: "hashicorp", Name: "aws"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Configuration{DefaultProviderHostname: tt.hostname}
+			got, err := config.NewProvider(tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("NewProvider(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
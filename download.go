@@ -1,8 +1,7 @@
 package main
 
 import (
-	"crypto/sha256"
-	"encoding/json"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,79 +10,68 @@ import (
 
 var httpClient = &http.Client{Timeout: 60 * time.Second}
 
-var retrySleep = func(retries int) {
-	sleepFor := retries * retries
-	sugar.Warnf("sleeping %d seconds", sleepFor)
-	time.Sleep(time.Duration(sleepFor) * time.Second)
+var retrySleep = func(ctx context.Context, retries int, backoff time.Duration) {
+	sleepFor := time.Duration(retries*retries) * backoff
+	sugar.Warnf("sleeping %s", sleepFor)
+	sleepWithContext(ctx, sleepFor)
 }
 
 func (pp HCTFProviderPlatform) String() string {
 	return fmt.Sprintf("%s_%s", pp.OS, pp.Arch)
 }
 
-func (d *ProviderDownloader) MirrorProviderInstanceToDest(pi ProviderSpecificInstance) (psib *ProviderSpecificInstanceBinary, err error) {
+func (d *ProviderDownloader) MirrorProviderInstanceToDest(ctx context.Context, pi ProviderSpecificInstance) (psib *ProviderSpecificInstanceBinary, err error) {
 	sugar.Infof("mirroring PVI %s", pi)
 
-	downloadResponseUrl := fmt.Sprintf("https://%s/v1/providers/%s/%s/%s/download/%s/%s", pi.Hostname, pi.Owner, pi.Name, pi.Version, pi.OS, pi.Arch)
+	providerLabel := pi.Provider.String()
+	platformLabel := fmt.Sprintf("%s_%s", pi.OS, pi.Arch)
+	metricDownloadsAttempted.WithLabelValues(providerLabel, platformLabel).Inc()
+
+	source := d.Source
+	if source == nil {
+		source = registrySource{}
+	}
 
 	retries := 0
-	maxRetries := 5
+	maxRetries := d.Retry.maxAttempts()
 
 	var lastErr error
 
 	for retries < maxRetries {
+		// once the sync is being shut down there is no point in retrying, and nothing has been written yet
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		sugar.Debugf("starting download for PVI %s", pi)
 		if retries > 0 {
-			retrySleep(retries)
-		}
-
-		req, err := http.NewRequest(http.MethodGet, downloadResponseUrl, nil)
-		if err != nil {
-			lastErr = err
-			sugar.Errorf("error making HTTP request for PVI %s: %v", pi, err)
-			retries += 1
-			continue
-		}
-		resp, err := httpClient.Do(req)
-		if err != nil {
-			lastErr = err
-			sugar.Errorf("error getting HTTP response for PVI %s: %v", pi, err)
-			retries += 1
-			continue
-		}
-		if resp.StatusCode >= 400 {
-			_ = resp.Body.Close()
-			lastErr = fmt.Errorf("HTTP %d from registry for PVI %s", resp.StatusCode, pi)
-			sugar.Errorf("error getting HTTP response for PVI %s: %v", pi, lastErr)
-			retries += 1
-			continue
+			metricDownloadRetries.WithLabelValues(providerLabel, platformLabel).Inc()
+			retrySleep(ctx, retries, d.Retry.backoff())
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
 		}
 
-		respBody, err := io.ReadAll(resp.Body)
-		_ = resp.Body.Close()
+		info, err := source.GetDownloadInfo(ctx, pi)
 		if err != nil {
 			lastErr = err
-			sugar.Errorf("error reading HTTP response body for PVI %s: %v", pi, err)
+			sugar.Errorf("error getting download info for PVI %s: %v", pi, err)
 			retries += 1
 			continue
 		}
-
-		var registryDownloadResponse HCTFRegistryDownloadResponse
-		err = json.Unmarshal(respBody, &registryDownloadResponse)
-		if err != nil {
-			lastErr = err
-			sugar.Errorf("error unmarshalling response body for PVI %s: %v", pi, err)
-			retries += 1
-			continue
+		if d.Verification.RequireHashes && info.SHA256 == "" && len(info.Hashes) == 0 {
+			// asking again would not bring hashes along
+			metricDownloadsFailed.WithLabelValues(providerLabel, platformLabel).Inc()
+			return nil, fmt.Errorf("upstream has no checksum for PVI %s and require_hashes is set", pi)
 		}
 
-		downloadReq, err := http.NewRequest(http.MethodGet, registryDownloadResponse.DownloadURL, nil)
+		downloadReq, err := http.NewRequestWithContext(ctx, http.MethodGet, info.URL, nil)
 		if err != nil {
 			lastErr = err
 			sugar.Errorf("error making HTTP download request for PVI %s: %v", pi, err)
 			retries += 1
 			continue
 		}
+		authorizeRegistryRequest(downloadReq, info.Token)
 		downloadResp, err := httpClient.Do(downloadReq)
 		if err != nil {
 			lastErr = err
@@ -93,13 +81,17 @@ func (d *ProviderDownloader) MirrorProviderInstanceToDest(pi ProviderSpecificIns
 		}
 		if downloadResp.StatusCode >= 400 {
 			_ = downloadResp.Body.Close()
+			// the next attempt asks the registry again, in case the download URL has expired; a transport error
+			// or a shutdown says nothing about the URL, so the cached download info is kept for those
+			if ctx.Err() == nil {
+				registryResponses.forget(info.cacheKey)
+			}
 			lastErr = fmt.Errorf("HTTP %d downloading binary for PVI %s", downloadResp.StatusCode, pi)
 			sugar.Errorf("error downloading binary for PVI %s: %v", pi, lastErr)
 			retries += 1
 			continue
 		}
 
-		hasher := sha256.New()
 		providerBinary, err := io.ReadAll(downloadResp.Body)
 		_ = downloadResp.Body.Close()
 		if err != nil {
@@ -108,19 +100,16 @@ func (d *ProviderDownloader) MirrorProviderInstanceToDest(pi ProviderSpecificIns
 			retries += 1
 			continue
 		}
+		metricBytesDownloaded.WithLabelValues(providerLabel).Add(float64(len(providerBinary)))
 
-		_, err = hasher.Write(providerBinary)
+		err = info.verify(providerBinary)
 		if err != nil {
+			if ctx.Err() == nil {
+				registryResponses.forget(info.cacheKey)
+			}
 			lastErr = err
-			sugar.Errorf("error checksumming provider for PVI %s: %v", pi, err)
-			retries += 1
-			continue
-		}
-
-		checksum := fmt.Sprintf("%x", hasher.Sum(nil))
-		if checksum != registryDownloadResponse.Shasum {
-			lastErr = fmt.Errorf("got SHA %s, expected %s", checksum, registryDownloadResponse.Shasum)
 			sugar.Errorf("checksum mismatch for PVI %s: %v", pi, lastErr)
+			metricChecksumMismatches.WithLabelValues(providerLabel, platformLabel).Inc()
 			retries += 1
 			continue
 		}
@@ -133,9 +122,11 @@ func (d *ProviderDownloader) MirrorProviderInstanceToDest(pi ProviderSpecificIns
 			continue
 		}
 
+		metricDownloadsSucceeded.WithLabelValues(providerLabel, platformLabel).Inc()
 		return psib, nil
 	}
 
+	metricDownloadsFailed.WithLabelValues(providerLabel, platformLabel).Inc()
 	sugar.Errorf("hit max retries of %d for PVI %s", maxRetries, pi)
 	return nil, lastErr
 }
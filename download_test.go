@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestHCTFProviderPlatformString(t *testing.T) {
@@ -101,7 +106,7 @@ func TestFilterVersionsWithFailedPSIBs(t *testing.T) {
 
 func TestMirrorProviderInstanceToDest(t *testing.T) {
 	origSleep := retrySleep
-	retrySleep = func(int) {}
+	retrySleep = func(context.Context, int, time.Duration) {}
 	defer func() { retrySleep = origSleep }()
 
 	origClient := httpClient
@@ -154,7 +159,7 @@ func TestMirrorProviderInstanceToDest(t *testing.T) {
 		}
 
 		d := ProviderDownloader{Storage: mock}
-		psib, err := d.MirrorProviderInstanceToDest(localPI)
+		psib, err := d.MirrorProviderInstanceToDest(t.Context(), localPI)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -164,6 +169,27 @@ func TestMirrorProviderInstanceToDest(t *testing.T) {
 		if !writeCalled {
 			t.Error("expected WriteProviderBinaryDataToStorage to be called")
 		}
+		if got := testutil.ToFloat64(metricDownloadsSucceeded.WithLabelValues(localPI.Provider.String(), "linux_amd64")); got != 1 {
+			t.Errorf("succeeded downloads metric = %v, want 1", got)
+		}
+	})
+
+	t.Run("cancelled context stops without writing", func(t *testing.T) {
+		mock := mockProviderStorer{
+			writeProviderBinaryDataToStorageFunc: func(data []byte, p ProviderSpecificInstance) (*ProviderSpecificInstanceBinary, error) {
+				t.Fatal("should not be called")
+				return nil, nil
+			},
+		}
+
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+
+		d := ProviderDownloader{Storage: mock}
+		_, err := d.MirrorProviderInstanceToDest(ctx, pi)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
 	})
 
 	t.Run("registry returns 404 errors after max retries", func(t *testing.T) {
@@ -185,7 +211,7 @@ func TestMirrorProviderInstanceToDest(t *testing.T) {
 		}
 
 		d := ProviderDownloader{Storage: mock}
-		_, err := d.MirrorProviderInstanceToDest(localPI)
+		_, err := d.MirrorProviderInstanceToDest(t.Context(), localPI)
 		if err == nil {
 			t.Fatal("expected error, got nil")
 		}
@@ -218,7 +244,7 @@ func TestMirrorProviderInstanceToDest(t *testing.T) {
 		}
 
 		d := ProviderDownloader{Storage: mock}
-		_, err := d.MirrorProviderInstanceToDest(localPI)
+		_, err := d.MirrorProviderInstanceToDest(t.Context(), localPI)
 		if err == nil {
 			t.Fatal("expected error, got nil")
 		}
@@ -254,7 +280,7 @@ func TestMirrorProviderInstanceToDest(t *testing.T) {
 		}
 
 		d := ProviderDownloader{Storage: mock}
-		_, err := d.MirrorProviderInstanceToDest(localPI)
+		_, err := d.MirrorProviderInstanceToDest(t.Context(), localPI)
 		if err == nil {
 			t.Fatal("expected error, got nil")
 		}
@@ -289,7 +315,7 @@ func TestMirrorProviderInstanceToDest(t *testing.T) {
 		}
 
 		d := ProviderDownloader{Storage: mock}
-		_, err := d.MirrorProviderInstanceToDest(localPI)
+		_, err := d.MirrorProviderInstanceToDest(t.Context(), localPI)
 		if err == nil {
 			t.Fatal("expected error, got nil")
 		}
@@ -334,7 +360,7 @@ func TestMirrorProviderInstanceToDest(t *testing.T) {
 		}
 
 		d := ProviderDownloader{Storage: mock}
-		psib, err := d.MirrorProviderInstanceToDest(localPI)
+		psib, err := d.MirrorProviderInstanceToDest(t.Context(), localPI)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -346,3 +372,113 @@ func TestMirrorProviderInstanceToDest(t *testing.T) {
 		}
 	})
 }
+
+func TestMirrorProviderInstanceToDestRetryAndVerification(t *testing.T) {
+	var sleeps []time.Duration
+	origSleep := retrySleep
+	retrySleep = func(ctx context.Context, retries int, backoff time.Duration) {
+		sleeps = append(sleeps, time.Duration(retries*retries)*backoff)
+	}
+	defer func() { retrySleep = origSleep }()
+	origClient := httpClient
+	defer func() { httpClient = origClient }()
+
+	infoRequests, downloads := 0, 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/providers/hashicorp/aws/5.0.0/download/linux/amd64":
+			infoRequests++
+			_ = json.NewEncoder(w).Encode(HCTFRegistryDownloadResponse{DownloadURL: fmt.Sprintf("https://%s/download/aws.zip", r.Host)})
+		case "/download/aws.zip":
+			downloads++
+			w.WriteHeader(502)
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+	httpClient = server.Client()
+
+	pi := ProviderSpecificInstance{
+		Provider: Provider{Hostname: server.URL[len("https://"):], Owner: "hashicorp", Name: "aws"},
+		Version:  "5.0.0",
+		OS:       "linux",
+		Arch:     "amd64",
+	}
+	mock := mockProviderStorer{
+		writeProviderBinaryDataToStorageFunc: func(data []byte, p ProviderSpecificInstance) (*ProviderSpecificInstanceBinary, error) {
+			t.Fatal("should not be called")
+			return nil, nil
+		},
+	}
+
+	d := ProviderDownloader{Storage: mock, Retry: retryConfig{MaxAttempts: 3, Backoff: 2 * time.Second}}
+	_, err := d.MirrorProviderInstanceToDest(t.Context(), pi)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if downloads != 3 {
+		t.Errorf("downloaded %d times, want 3", downloads)
+	}
+	// an error status may mean the download URL has expired, so each attempt asks for it again
+	if infoRequests != 3 {
+		t.Errorf("got %d download info requests, want 3", infoRequests)
+	}
+	if fmt.Sprint(sleeps) != "[2s 8s]" {
+		t.Errorf("slept %v, want [2s 8s]", sleeps)
+	}
+
+	infoRequests, downloads = 0, 0
+	d = ProviderDownloader{Storage: mock, Verification: verificationConfig{RequireHashes: true}}
+	_, err = d.MirrorProviderInstanceToDest(t.Context(), pi)
+	if err == nil {
+		t.Fatal("expected error for a download without a checksum")
+	}
+	if infoRequests != 1 || downloads != 0 {
+		t.Errorf("got %d download info requests and %d downloads, want 1 and 0", infoRequests, downloads)
+	}
+}
+
+func TestMirrorProviderInstanceToDestKeepsDownloadInfoOnTransportErrors(t *testing.T) {
+	origSleep := retrySleep
+	retrySleep = func(ctx context.Context, retries int, backoff time.Duration) {}
+	defer func() { retrySleep = origSleep }()
+	origClient := httpClient
+	defer func() { httpClient = origClient }()
+
+	infoRequests, downloads := 0, 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/providers/hashicorp/aws/5.0.0/download/linux/amd64":
+			infoRequests++
+			_ = json.NewEncoder(w).Encode(HCTFRegistryDownloadResponse{DownloadURL: fmt.Sprintf("https://%s/download/aws.zip", r.Host)})
+		case "/download/aws.zip":
+			downloads++
+			// the connection is dropped without a response
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				_ = conn.Close()
+			}
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+	httpClient = server.Client()
+
+	pi := ProviderSpecificInstance{
+		Provider: Provider{Hostname: server.URL[len("https://"):], Owner: "hashicorp", Name: "aws"},
+		Version:  "5.0.0",
+		OS:       "linux",
+		Arch:     "amd64",
+	}
+	d := ProviderDownloader{Storage: mockProviderStorer{}, Retry: retryConfig{MaxAttempts: 3}}
+	_, err := d.MirrorProviderInstanceToDest(t.Context(), pi)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	// net/http retries a dropped GET by itself, so there are more downloads than attempts
+	if downloads < 3 || infoRequests != 1 {
+		t.Errorf("got %d download info requests and %d downloads, want 1 and at least 3", infoRequests, downloads)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// wraps anything that goes wrong while loading or interpreting the configuration file
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("config error: %v", e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// returned by commands that work through every configured provider when one or more of them failed;
+// Errors holds what went wrong for each failed provider, where it is known
+type ProviderFailuresError struct {
+	Failed int
+	Total  int
+	Errors []error
+}
+
+func (e *ProviderFailuresError) Error() string {
+	msg := fmt.Sprintf("%d of %d providers failed", e.Failed, e.Total)
+	if len(e.Errors) == 0 {
+		return msg
+	}
+	details := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		details[i] = err.Error()
+	}
+	return msg + ": " + strings.Join(details, "; ")
+}
+
+func (e *ProviderFailuresError) Unwrap() []error {
+	return e.Errors
+}
+
+func (e *ProviderFailuresError) Partial() bool {
+	return e.Failed < e.Total
+}
+
+// returned when some instances of a provider could not be mirrored
+type InstanceFailuresError struct {
+	Provider string
+	Failures []InstanceFailure
+}
+
+type InstanceFailure struct {
+	Instance ProviderSpecificInstance
+	Err      error
+}
+
+func (e *InstanceFailuresError) Error() string {
+	return fmt.Sprintf("failed to mirror %d instances of provider %s", len(e.Failures), e.Provider)
+}
+
+func (e *InstanceFailuresError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failures))
+	for _, failure := range e.Failures {
+		if failure.Err != nil {
+			errs = append(errs, failure.Err)
+		}
+	}
+	return errs
+}
+
+// returned by a single sync that a shutdown signal stopped before it was done, which leaves the mirror
+// partly synced and so is not a success
+type InterruptedError struct {
+	Err error
+}
+
+func (e *InterruptedError) Error() string {
+	return fmt.Sprintf("sync was interrupted: %v", e.Err)
+}
+
+func (e *InterruptedError) Unwrap() error {
+	return e.Err
+}
+
+// usage errors come from bad command line flags and have already been reported to the user by the time they are returned
+type UsageError struct {
+	Err error
+}
+
+func (e *UsageError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UsageError) Unwrap() error {
+	return e.Err
+}
+
+func exitCodeForError(err error) int {
+	if err == nil || errors.Is(err, flag.ErrHelp) {
+		return exitCodeOK
+	}
+
+	var configErr *ConfigError
+	var usageErr *UsageError
+	var failuresErr *ProviderFailuresError
+	var interruptedErr *InterruptedError
+	switch {
+	case errors.As(err, &usageErr):
+		return exitCodeUsage
+	case errors.As(err, &configErr):
+		return exitCodeConfig
+	case errors.As(err, &interruptedErr):
+		return exitCodePartialFailure
+	case errors.As(err, &failuresErr) && failuresErr.Partial():
+		return exitCodePartialFailure
+	}
+	return exitCodeTotalFailure
+}
+
+// decides whether a sync where some providers failed should make the process exit non-zero
+type failurePolicy struct {
+	// "any", "total" or "threshold"
+	mode string
+	// for threshold, the number or percentage of failed providers at which the sync fails
+	threshold int
+	percent   bool
+}
+
+// accepts "any", "total", a number of providers such as "3" or a percentage such as "25%"
+func parseFailurePolicy(s string) (failurePolicy, error) {
+	switch s {
+	case "any", "total":
+		return failurePolicy{mode: s}, nil
+	}
+	number, percent := strings.CutSuffix(s, "%")
+	threshold, err := strconv.Atoi(number)
+	if err != nil || threshold < 1 || (percent && threshold > 100) {
+		return failurePolicy{}, fmt.Errorf("invalid failure policy %q, expected any, total, a number of providers or a percentage", s)
+	}
+	return failurePolicy{mode: "threshold", threshold: threshold, percent: percent}, nil
+}
+
+// whether err is a provider failure that the policy lets through; anything else is never tolerated
+func (p failurePolicy) tolerates(err error) bool {
+	var failuresErr *ProviderFailuresError
+	if !errors.As(err, &failuresErr) {
+		return false
+	}
+	switch p.mode {
+	case "total":
+		return failuresErr.Partial()
+	case "threshold":
+		if p.percent {
+			return failuresErr.Failed*100 < p.threshold*failuresErr.Total
+		}
+		return failuresErr.Failed < p.threshold
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"testing"
+)
+
+func TestExitCodeForError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"nil", nil, exitCodeOK},
+		{"help", &UsageError{flag.ErrHelp}, exitCodeOK},
+		{"usage", &UsageError{errors.New("bad flag")}, exitCodeUsage},
+		{"config", &ConfigError{errors.New("bad yaml")}, exitCodeConfig},
+		{"wrapped config", fmt.Errorf("loading: %w", &ConfigError{errors.New("bad yaml")}), exitCodeConfig},
+		{"partial failure", &ProviderFailuresError{Failed: 1, Total: 3}, exitCodePartialFailure},
+		{"total failure", &ProviderFailuresError{Failed: 3, Total: 3}, exitCodeTotalFailure},
+		{"other error", errors.New("boom"), exitCodeTotalFailure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := exitCodeForError(tt.err)
+			if got != tt.expected {
+				t.Errorf("exitCodeForError(%v) = %d, want %d", tt.err, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRunUsageExitCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected int
+	}{
+		{"no command", nil, exitCodeUsage},
+		{"unknown command", []string{"bogus"}, exitCodeUsage},
+		{"command help", []string{"sync", "-h"}, exitCodeOK},
+		{"invalid failure policy", []string{"sync", "--fail-on", "some"}, exitCodeUsage},
+		{"unexpected argument", []string{"list", "extra"}, exitCodeUsage},
+		{"missing config", []string{"--config-path", "/nonexistent/config.yaml", "list"}, exitCodeConfig},
+		{"missing config after command", []string{"list", "--config-path", "/nonexistent/config.yaml"}, exitCodeConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := run(tt.args)
+			if got != tt.expected {
+				t.Errorf("run(%v) = %d, want %d", tt.args, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestProviderFailuresError(t *testing.T) {
+	instanceErr := &InstanceFailuresError{
+		Provider: "registry.terraform.io/hashicorp/aws",
+		Failures: []InstanceFailure{{Instance: ProviderSpecificInstance{Version: "5.0.0", OS: "linux", Arch: "amd64"}, Err: errors.New("boom")}},
+	}
+	err := &ProviderFailuresError{
+		Failed: 2,
+		Total:  3,
+		Errors: []error{instanceErr, errors.New("error getting metadata for provider random")},
+	}
+
+	want := "2 of 3 providers failed: failed to mirror 1 instances of provider registry.terraform.io/hashicorp/aws; error getting metadata for provider random"
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+
+	var got *InstanceFailuresError
+	if !errors.As(err, &got) || got != instanceErr {
+		t.Errorf("per-instance failures are not reachable through errors.As")
+	}
+}
+
+func TestInstanceFailuresErrorUnwrap(t *testing.T) {
+	errNotFound := errors.New("HTTP 404")
+	err := &InstanceFailuresError{
+		Provider: "registry.terraform.io/hashicorp/aws",
+		Failures: []InstanceFailure{
+			{Instance: ProviderSpecificInstance{Version: "5.0.0", OS: "linux", Arch: "amd64"}, Err: fmt.Errorf("error downloading: %w", errNotFound)},
+			{Instance: ProviderSpecificInstance{Version: "5.0.0", OS: "darwin", Arch: "arm64"}, Err: context.Canceled},
+		},
+	}
+	// wrapped in a provider failure, as sync returns it
+	wrapped := &ProviderFailuresError{Failed: 1, Total: 1, Errors: []error{err}}
+
+	for _, target := range []error{errNotFound, context.Canceled} {
+		if !errors.Is(err, target) || !errors.Is(wrapped, target) {
+			t.Errorf("%v is not reachable through errors.Is", target)
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		t.Error("errors.Is matched an error that is not wrapped")
+	}
+}
+
+func TestFailurePolicy(t *testing.T) {
+	partial := &ProviderFailuresError{Failed: 1, Total: 4}
+	half := &ProviderFailuresError{Failed: 2, Total: 4}
+	total := &ProviderFailuresError{Failed: 4, Total: 4}
+	other := errors.New("boom")
+
+	tests := []struct {
+		policy    string
+		err       error
+		tolerated bool
+	}{
+		{"any", partial, false},
+		{"any", nil, false},
+		{"total", partial, true},
+		{"total", total, false},
+		{"total", other, false},
+		{"2", partial, true},
+		{"2", half, false},
+		{"50%", partial, true},
+		{"50%", half, false},
+		{"50%", fmt.Errorf("wrapped: %w", partial), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %v", tt.policy, tt.err), func(t *testing.T) {
+			policy, err := parseFailurePolicy(tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := policy.tolerates(tt.err); got != tt.tolerated {
+				t.Errorf("tolerates() = %v, want %v", got, tt.tolerated)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"", "some", "0", "-1", "150%", "%"} {
+		if _, err := parseFailurePolicy(invalid); err == nil {
+			t.Errorf("parseFailurePolicy(%q) should fail", invalid)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// the h1: hash of a provider zip, the same as dirhash.HashZip gives for the file but without needing one on disk
+func h1HashOfZip(data []byte) (string, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	files := make([]string, 0, len(reader.File))
+	byName := make(map[string]*zip.File, len(reader.File))
+	for _, file := range reader.File {
+		files = append(files, file.Name)
+		byName[file.Name] = file
+	}
+	sort.Strings(files)
+	return dirhash.Hash1(files, func(name string) (io.ReadCloser, error) {
+		return byName[name].Open()
+	})
+}
+
+// the zh: hash of a provider zip, which is the SHA256 that registries publish in their SHA256SUMS files
+func zhHashOfZip(data []byte) string {
+	return fmt.Sprintf("zh:%x", sha256.Sum256(data))
+}
+
+// the zh: hash of a provider zip on disk, read without holding the whole file in memory
+func zhHashOfZipFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	hash := sha256.New()
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("zh:%x", hash.Sum(nil)), nil
+}
+
+// checks a downloaded zip against hashes in the h1: and zh: formats used by mirrors and lock files;
+// hashes in other formats are ignored, and it is enough for one hash to match
+func verifyZipHashes(data []byte, hashes []string) error {
+	var h1 string
+	checked := false
+	for _, hash := range hashes {
+		switch {
+		case strings.HasPrefix(hash, "h1:"):
+			if h1 == "" {
+				var err error
+				h1, err = h1HashOfZip(data)
+				if err != nil {
+					return fmt.Errorf("error hashing zip: %w", err)
+				}
+			}
+			if hash == h1 {
+				return nil
+			}
+			checked = true
+		case strings.HasPrefix(hash, "zh:"):
+			if hash == zhHashOfZip(data) {
+				return nil
+			}
+			checked = true
+		}
+	}
+	if !checked {
+		return fmt.Errorf("none of the hashes %v is in a known format", hashes)
+	}
+	return fmt.Errorf("zip does not match any of %v", hashes)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+)
+
+func TestH1HashOfZip(t *testing.T) {
+	zipBytes, want := createTestZip(t, "terraform-provider-aws_v5.0.0", "binary")
+	got, err := h1HashOfZip(zipBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("h1HashOfZip() = %q, want %q as from dirhash.HashZip", got, want)
+	}
+
+	if _, err := h1HashOfZip([]byte("not a zip")); err == nil {
+		t.Error("expected an error for data that is not a zip")
+	}
+}
+
+func TestVerifyZipHashes(t *testing.T) {
+	zipBytes, h1 := createTestZip(t, "terraform-provider-aws_v5.0.0", "binary")
+	zh := fmt.Sprintf("zh:%x", sha256.Sum256(zipBytes))
+	otherBytes, otherH1 := createTestZip(t, "terraform-provider-aws_v5.0.0", "other")
+	otherZH := fmt.Sprintf("zh:%x", sha256.Sum256(otherBytes))
+
+	tests := []struct {
+		name    string
+		hashes  []string
+		wantErr bool
+	}{
+		{"matching h1", []string{h1}, false},
+		{"matching zh", []string{zh}, false},
+		{"one of several matches", []string{otherH1, otherZH, h1}, false},
+		{"no match", []string{otherH1, otherZH}, true},
+		{"unknown formats only", []string{"md5:abc"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyZipHashes(zipBytes, tt.hashes)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyZipHashes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
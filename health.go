@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// tracks how far the sync loop has got, for the health and readiness endpoints
+type syncStatus struct {
+	mu               sync.Mutex
+	lastProgress     time.Time
+	idleUntil        time.Time
+	lastSyncFinished time.Time
+}
+
+// there is only ever one sync loop per process, so like the metrics this lives at package level
+var syncHealth = &syncStatus{}
+
+// records that the sync is doing work
+func (s *syncStatus) progress() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastProgress = time.Now()
+	s.idleUntil = time.Time{}
+}
+
+// records that a full pass over every provider has finished
+func (s *syncStatus) finished() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastProgress = time.Now()
+	s.lastSyncFinished = s.lastProgress
+}
+
+// records that the loop is deliberately waiting until the given time
+func (s *syncStatus) idle(until time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastProgress = time.Now()
+	s.idleUntil = until
+}
+
+// the loop is considered wedged if it has not made progress within the timeout, not counting time spent waiting between loops
+func (s *syncStatus) checkLive(now time.Time, timeout time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deadline := s.lastProgress
+	if s.idleUntil.After(deadline) {
+		deadline = s.idleUntil
+	}
+	if now.Sub(deadline) > timeout {
+		return fmt.Errorf("no sync progress since %s", s.lastProgress.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (s *syncStatus) checkReady(now time.Time, maxAge time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastSyncFinished.IsZero() {
+		return fmt.Errorf("no sync has finished yet")
+	}
+	if now.Sub(s.lastSyncFinished) > maxAge {
+		return fmt.Errorf("last sync finished at %s", s.lastSyncFinished.Format(time.RFC3339))
+	}
+	return nil
+}
+
+type healthChecks struct {
+	status          *syncStatus
+	livenessTimeout time.Duration
+	readinessMaxAge time.Duration
+	destination     func() DownloadDestination
+	storage         *storageProbe
+}
+
+// the storage check behind /readyz. Its client is made once per destination rather than on every probe, which
+// for S3 would mean going through the credential chain every few seconds; a reload that changes the
+// destination gets a new one.
+type storageProbe struct {
+	mu          sync.Mutex
+	destination DownloadDestination
+	check       func(context.Context) error
+	// newStorageReachabilityCheck, replaced in tests
+	newCheck func(context.Context, DownloadDestination) (func(context.Context) error, error)
+}
+
+func newStorageProbe() *storageProbe {
+	return &storageProbe{newCheck: newStorageReachabilityCheck}
+}
+
+func (p *storageProbe) reachable(ctx context.Context, destination DownloadDestination) error {
+	p.mu.Lock()
+	if p.check == nil || destination != p.destination {
+		check, err := p.newCheck(ctx, destination)
+		if err != nil {
+			p.mu.Unlock()
+			return err
+		}
+		p.check = check
+		p.destination = destination
+	}
+	check := p.check
+	p.mu.Unlock()
+	return check(ctx)
+}
+
+func (h healthChecks) healthz(w http.ResponseWriter, r *http.Request) {
+	err := h.status.checkLive(time.Now(), h.livenessTimeout)
+	writeHealthResponse(w, err)
+}
+
+func (h healthChecks) readyz(w http.ResponseWriter, r *http.Request) {
+	err := h.status.checkReady(time.Now(), h.readinessMaxAge)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+		err = h.storage.reachable(ctx, h.destination())
+		if err != nil {
+			err = fmt.Errorf("storage is not reachable: %w", err)
+		}
+	}
+	writeHealthResponse(w, err)
+}
+
+func writeHealthResponse(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = fmt.Fprintf(w, "%v\n", err)
+		return
+	}
+	_, _ = fmt.Fprintln(w, "ok")
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSyncStatusCheckLive(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		status  *syncStatus
+		wantErr bool
+	}{
+		{"recent progress", &syncStatus{lastProgress: now.Add(-time.Minute)}, false},
+		{"stale progress", &syncStatus{lastProgress: now.Add(-2 * time.Hour)}, true},
+		{"idle between loops", &syncStatus{lastProgress: now.Add(-5 * time.Hour), idleUntil: now.Add(time.Hour)}, false},
+		{"overslept", &syncStatus{lastProgress: now.Add(-8 * time.Hour), idleUntil: now.Add(-2 * time.Hour)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.status.checkLive(now, time.Hour)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkLive() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSyncStatusCheckReady(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		status  *syncStatus
+		wantErr bool
+	}{
+		{"never finished", &syncStatus{lastProgress: now}, true},
+		{"recently finished", &syncStatus{lastSyncFinished: now.Add(-time.Hour)}, false},
+		{"finished too long ago", &syncStatus{lastSyncFinished: now.Add(-13 * time.Hour)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.status.checkReady(now, 12*time.Hour)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkReady() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSyncStatusTransitions(t *testing.T) {
+	s := &syncStatus{}
+	s.idle(time.Now().Add(time.Hour))
+	if s.idleUntil.IsZero() {
+		t.Fatal("expected idle deadline to be set")
+	}
+	s.progress()
+	if !s.idleUntil.IsZero() {
+		t.Error("expected progress to clear the idle deadline")
+	}
+	s.finished()
+	if s.lastSyncFinished.IsZero() {
+		t.Error("expected finished to record the sync time")
+	}
+}
+
+func TestCheckFSStorageReachable(t *testing.T) {
+	dir := t.TempDir()
+	if err := CheckStorageReachable(t.Context(), DownloadDestination{Type: STORAGE_TYPE_FS, FSConfig: fsConfig{DownloadRoot: dir}}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	missing := filepath.Join(dir, "missing")
+	if err := CheckStorageReachable(t.Context(), DownloadDestination{Type: STORAGE_TYPE_FS, FSConfig: fsConfig{DownloadRoot: missing}}); err == nil {
+		t.Error("expected error for missing download root")
+	}
+}
+
+func TestStorageProbeReusesClient(t *testing.T) {
+	builds, checks := 0, 0
+	probe := newStorageProbe()
+	probe.newCheck = func(ctx context.Context, destination DownloadDestination) (func(context.Context) error, error) {
+		builds++
+		return func(context.Context) error {
+			checks++
+			return nil
+		}, nil
+	}
+
+	first := DownloadDestination{Type: STORAGE_TYPE_S3, S3Config: s3Config{Bucket: "mirror"}}
+	for range 3 {
+		if err := probe.reachable(t.Context(), first); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if builds != 1 || checks != 3 {
+		t.Errorf("got %d clients for %d probes, want 1 for 3", builds, checks)
+	}
+
+	// a reloaded config with another destination gets a new client
+	reloaded := DownloadDestination{Type: STORAGE_TYPE_S3, S3Config: s3Config{Bucket: "other"}}
+	if err := probe.reachable(t.Context(), reloaded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if builds != 2 {
+		t.Errorf("got %d clients after the destination changed, want 2", builds)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"os"
 	"testing"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -14,11 +15,21 @@ func TestMain(m *testing.M) {
 }
 
 type mockProviderStorer struct {
-	loadCatalogFunc                      func() ([]ProviderSpecificInstanceBinary, error)
-	verifyCatalogAgainstStorageFunc      func(catalog []ProviderSpecificInstanceBinary) ([]ProviderSpecificInstanceBinary, []ProviderSpecificInstanceBinary, error)
-	reconcileWantedProviderInstancesFunc func(validPSIBs []ProviderSpecificInstanceBinary, invalidPSIBs []ProviderSpecificInstanceBinary, wantedProviderInstances []ProviderSpecificInstance) []ProviderSpecificInstance
-	writeProviderBinaryDataToStorageFunc func(binaryData []byte, pi ProviderSpecificInstance) (*ProviderSpecificInstanceBinary, error)
-	storeCatalogFunc                     func([]ProviderSpecificInstanceBinary) error
+	loadCatalogFunc                       func() ([]ProviderSpecificInstanceBinary, error)
+	verifyCatalogAgainstStorageFunc       func(catalog []ProviderSpecificInstanceBinary) ([]ProviderSpecificInstanceBinary, []ProviderSpecificInstanceBinary, error)
+	reconcileWantedProviderInstancesFunc  func(validPSIBs []ProviderSpecificInstanceBinary, invalidPSIBs []ProviderSpecificInstanceBinary, wantedProviderInstances []ProviderSpecificInstance) []ProviderSpecificInstance
+	writeProviderBinaryDataToStorageFunc  func(binaryData []byte, pi ProviderSpecificInstance) (*ProviderSpecificInstanceBinary, error)
+	readProviderBinaryDataFromStorageFunc func(psib ProviderSpecificInstanceBinary) ([]byte, error)
+	deleteProviderBinaryFromStorageFunc   func(psib ProviderSpecificInstanceBinary) error
+	storeCatalogFunc                      func([]ProviderSpecificInstanceBinary) error
+}
+
+func (m mockProviderStorer) LoadFirstSeen() (map[string]time.Time, error) {
+	return map[string]time.Time{}, nil
+}
+
+func (m mockProviderStorer) StoreFirstSeen(firstSeen map[string]time.Time) error {
+	return nil
 }
 
 func (m mockProviderStorer) LoadCatalog() ([]ProviderSpecificInstanceBinary, error) {
@@ -37,6 +48,14 @@ func (m mockProviderStorer) WriteProviderBinaryDataToStorage(binaryData []byte,
 	return m.writeProviderBinaryDataToStorageFunc(binaryData, pi)
 }
 
+func (m mockProviderStorer) ReadProviderBinaryDataFromStorage(psib ProviderSpecificInstanceBinary) ([]byte, error) {
+	return m.readProviderBinaryDataFromStorageFunc(psib)
+}
+
+func (m mockProviderStorer) DeleteProviderBinaryFromStorage(psib ProviderSpecificInstanceBinary) error {
+	return m.deleteProviderBinaryFromStorageFunc(psib)
+}
+
 func (m mockProviderStorer) StoreCatalog(psibs []ProviderSpecificInstanceBinary) error {
 	return m.storeCatalogFunc(psibs)
 }
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	interpolationFilePrefix = "file:"
+	// what secrets are replaced with when the config is logged
+	redactedValue = "REDACTED"
+)
+
+// expands ${NAME}, ${NAME:-default}, ${file:/path} and ${file:/path:-default} in every string value of the
+// config. A variable or file without a default must exist. The values that were substituted are returned
+// so that they can be kept out of logs.
+func interpolateConfig(raw *configRaw) (secrets []string, err error) {
+	var errs []string
+	interpolateValue(reflect.ValueOf(raw).Elem(), &secrets, &errs)
+	if len(errs) > 0 {
+		return secrets, fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+	return secrets, nil
+}
+
+func interpolateValue(v reflect.Value, secrets *[]string, errs *[]string) {
+	switch v.Kind() {
+	case reflect.String:
+		expanded, substituted, err := interpolateString(v.String())
+		if err != nil {
+			*errs = append(*errs, err.Error())
+			return
+		}
+		*secrets = append(*secrets, substituted...)
+		v.SetString(expanded)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				interpolateValue(v.Field(i), secrets, errs)
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			interpolateValue(v.Index(i), secrets, errs)
+		}
+	case reflect.Map:
+		// map values cannot be set in place, so each one is copied, expanded and put back
+		for _, key := range v.MapKeys() {
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(v.MapIndex(key))
+			interpolateValue(value, secrets, errs)
+			v.SetMapIndex(key, value)
+		}
+	}
+}
+
+// expands the references in a single value, returning the non-empty values that came from the
+// environment or from files. $${ is a literal ${.
+func interpolateString(s string) (string, []string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil, nil
+	}
+	var out strings.Builder
+	var substituted []string
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			out.WriteString(s)
+			break
+		}
+		if start > 0 && s[start-1] == '$' {
+			out.WriteString(s[:start-1] + "${")
+			s = s[start+2:]
+			continue
+		}
+		end := strings.Index(s[start:], "}")
+		if end < 0 {
+			return "", nil, fmt.Errorf("unterminated ${ in %q", s)
+		}
+		out.WriteString(s[:start])
+		value, fromSource, err := resolveReference(s[start+2 : start+end])
+		if err != nil {
+			return "", nil, err
+		}
+		if fromSource && value != "" {
+			substituted = append(substituted, value)
+		}
+		out.WriteString(value)
+		s = s[start+end+1:]
+	}
+	return out.String(), substituted, nil
+}
+
+// looks up what a single ${...} refers to. fromSource is false when the default was used.
+func resolveReference(reference string) (value string, fromSource bool, err error) {
+	name, defaultValue, hasDefault := strings.Cut(reference, ":-")
+	if path, isFile := strings.CutPrefix(name, interpolationFilePrefix); isFile {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if hasDefault {
+				return defaultValue, false, nil
+			}
+			// the error from ReadFile only names the path, never the contents
+			return "", false, fmt.Errorf("error reading ${%s}: %w", name, err)
+		}
+		// secret files usually end with a newline that is not part of the secret
+		return strings.TrimRight(string(data), "\r\n"), true, nil
+	}
+
+	if name == "" {
+		return "", false, fmt.Errorf("empty variable name in ${%s}", reference)
+	}
+	value, found := os.LookupEnv(name)
+	if value == "" && hasDefault {
+		return defaultValue, false, nil
+	}
+	if !found {
+		return "", false, fmt.Errorf("environment variable %s is not set and ${%s} has no default", name, name)
+	}
+	return value, true, nil
+}
+
+// the config as YAML, with registry tokens, webhooks and anything that was interpolated replaced by REDACTED
+func (c Configuration) String() string {
+	redacted := c
+	redacted.Credentials = make(map[string]registryCredentialsConfig, len(c.Credentials))
+	for hostname, credentials := range c.Credentials {
+		if credentials.Token != "" {
+			credentials.Token = redactedValue
+		}
+		redacted.Credentials[hostname] = credentials
+	}
+	// webhook URLs such as Slack's carry their secret in the path
+	redacted.Notifications.Webhooks = make([]webhookConfig, len(c.Notifications.Webhooks))
+	for i, webhook := range c.Notifications.Webhooks {
+		webhook.URL = redactedValue
+		headers := make(map[string]string, len(webhook.Headers))
+		for name := range webhook.Headers {
+			headers[name] = redactedValue
+		}
+		webhook.Headers = headers
+		redacted.Notifications.Webhooks[i] = webhook
+	}
+
+	// secrets are replaced in the values rather than in the output, where YAML may have quoted or split them
+	var node yaml.Node
+	err := node.Encode(redacted)
+	if err == nil {
+		redactScalars(&node, c.secrets)
+		var out []byte
+		out, err = yaml.Marshal(&node)
+		if err == nil {
+			return string(out)
+		}
+	}
+	return fmt.Sprintf("<unprintable config: %v>", err)
+}
+
+func redactScalars(node *yaml.Node, secrets []string) {
+	if node.Kind == yaml.ScalarNode {
+		for _, secret := range secrets {
+			node.Value = strings.ReplaceAll(node.Value, secret, redactedValue)
+		}
+	}
+	for _, child := range node.Content {
+		redactScalars(child, secrets)
+	}
+}
+
+// Configuration holds secrets, so %#v gets the redacted form as well
+func (c Configuration) GoString() string {
+	return c.String()
+}
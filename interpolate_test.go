@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInterpolateString(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "token")
+	err := os.WriteFile(secretFile, []byte("file-secret\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TFSPIEGEL_TEST_BUCKET", "my-bucket")
+	t.Setenv("TFSPIEGEL_TEST_EMPTY", "")
+
+	tests := []struct {
+		name            string
+		input           string
+		expected        string
+		wantSubstituted []string
+		wantErr         bool
+	}{
+		{"no references", "plain value", "plain value", nil, false},
+		{"environment variable", "${TFSPIEGEL_TEST_BUCKET}", "my-bucket", []string{"my-bucket"}, false},
+		{"inside other text", "s3://${TFSPIEGEL_TEST_BUCKET}/providers", "s3://my-bucket/providers", []string{"my-bucket"}, false},
+		{"default when unset", "${TFSPIEGEL_TEST_UNSET:-fallback}", "fallback", nil, false},
+		{"default when empty", "${TFSPIEGEL_TEST_EMPTY:-fallback}", "fallback", nil, false},
+		{"set but empty", "${TFSPIEGEL_TEST_EMPTY}", "", nil, false},
+		{"unset without default", "${TFSPIEGEL_TEST_UNSET}", "", nil, true},
+		{"file", "${file:" + secretFile + "}", "file-secret", []string{"file-secret"}, false},
+		{"missing file with default", "${file:" + filepath.Join(dir, "missing") + ":-none}", "none", nil, false},
+		{"missing file", "${file:" + filepath.Join(dir, "missing") + "}", "", nil, true},
+		{"escaped", "$${TFSPIEGEL_TEST_BUCKET}", "${TFSPIEGEL_TEST_BUCKET}", nil, false},
+		{"unterminated", "${TFSPIEGEL_TEST_BUCKET", "", nil, true},
+		{"empty name", "${}", "", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, substituted, err := interpolateString(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+			if fmt.Sprint(substituted) != fmt.Sprint(tt.wantSubstituted) {
+				t.Errorf("substituted %v, want %v", substituted, tt.wantSubstituted)
+			}
+		})
+	}
+}
+
+func TestParseConfigInterpolation(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	err := os.WriteFile(tokenFile, []byte("registry-token\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TFSPIEGEL_TEST_BUCKET", "secret-bucket")
+
+	config, err := parseConfig([]byte(`
+storage_type: s3
+s3_config:
+  bucket: ${TFSPIEGEL_TEST_BUCKET}
+  prefix: ${TFSPIEGEL_TEST_PREFIX:-providers}
+credentials:
+  registry.example.com:
+    token: ${file:` + tokenFile + `}
+notifications:
+  webhooks:
+    - url: https://hooks.slack.com/services/T0/B0/x
+providers:
+  - reference: aws
+    version_range: ">=5.0.0"
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.DownloadDestination.S3Config.Bucket != "secret-bucket" || config.DownloadDestination.S3Config.Prefix != "providers" {
+		t.Errorf("unexpected s3 config: %+v", config.DownloadDestination.S3Config)
+	}
+	if config.registryToken("registry.example.com") != "registry-token" {
+		t.Errorf("unexpected token: %q", config.registryToken("registry.example.com"))
+	}
+
+	for _, logged := range []string{config.String(), fmt.Sprintf("%v", config), fmt.Sprintf("%#v", config)} {
+		for _, secret := range []string{"secret-bucket", "registry-token", "hooks.slack.com"} {
+			if strings.Contains(logged, secret) {
+				t.Errorf("%q shows up in the logged config:\n%s", secret, logged)
+			}
+		}
+		if !strings.Contains(logged, "providers") {
+			t.Errorf("values that are not secret are missing from the logged config:\n%s", logged)
+		}
+	}
+
+	_, err = parseConfig([]byte(`
+storage_type: s3
+s3_config:
+  bucket: ${TFSPIEGEL_TEST_UNSET}
+providers: []
+`))
+	if err == nil || !strings.Contains(err.Error(), "TFSPIEGEL_TEST_UNSET is not set") {
+		t.Errorf("expected an error about the unset variable, got %v", err)
+	}
+}
+
+func TestParseConfigErrorsLeaveOutInterpolatedValues(t *testing.T) {
+	t.Setenv("TFSPIEGEL_TEST_MIRROR_URL", "mirror.example.com/user:hunter2")
+	t.Setenv("TFSPIEGEL_TEST_STORAGE", "s3-with-hunter2")
+	t.Setenv("TFSPIEGEL_TEST_LAYOUT", "hunter2")
+
+	for _, config := range []string{`
+storage_type: fs
+fs_config:
+  download_root: /mirror
+  layout: ${TFSPIEGEL_TEST_LAYOUT}
+upstreams:
+  internal:
+    type: network_mirror
+    url: ${TFSPIEGEL_TEST_MIRROR_URL}
+providers: []
+`, `
+storage_type: ${TFSPIEGEL_TEST_STORAGE}
+providers: []
+`} {
+		_, err := parseConfig([]byte(config))
+		if err == nil {
+			t.Fatal("expected an error, got nil")
+		}
+		if strings.Contains(err.Error(), "hunter2") {
+			t.Errorf("the error shows an interpolated value:\n%v", err)
+		}
+	}
+}
@@ -3,103 +3,236 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"net/url"
 	"os"
-	"runtime"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	awsconfig "github.com/aws/aws-sdk-go-v2/config"
-	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
-
+	semver "github.com/blang/semver/v4"
 	"go.uber.org/zap"
-	"gopkg.in/yaml.v3"
 )
 
 var sugar *zap.SugaredLogger
 
-func main() {
-	var configPath string
-	var loggerType string
-	var loop bool
-	var waitBetweenLoops time.Duration
+// options that are accepted both before the command name and by every command
+type globalOptions struct {
+	configPath string
+	loggerType string
+}
 
-	flag.StringVar(&configPath, "config-path", "config.yaml", "Path to configuration file")
-	flag.StringVar(&loggerType, "logger-type", "development", "Logger type (development or production)")
-	flag.BoolVar(&loop, "loop", false, "Loop on mirroring providers after a wait period")
-	flag.DurationVar(&waitBetweenLoops, "wait-between-loops", 6*time.Hour, "How long to wait between mirroring attempts when looping")
-	flag.Parse()
+func (g *globalOptions) register(fs *flag.FlagSet) {
+	// the current values are used as defaults so that registering on a command's flag set
+	// does not reset anything that was already parsed before the command name
+	fs.StringVar(&g.configPath, "config-path", g.configPath, "Path to the configuration file, or a directory or glob of configuration files")
+	fs.StringVar(&g.loggerType, "logger-type", g.loggerType, "Logger type (development or production)")
+}
 
-	if !StringInSlice(loggerType, []string{"development", "production"}) {
-		fmt.Fprintf(os.Stderr, "%s is not a valid logger type\n", loggerType)
-		os.Exit(1)
+// initializes the global logger and loads the configuration file, shared by every command
+func (g *globalOptions) setup() (Configuration, *zap.Logger, error) {
+	if !StringInSlice(g.loggerType, []string{"development", "production"}) {
+		err := fmt.Errorf("%s is not a valid logger type", g.loggerType)
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return Configuration{}, nil, &UsageError{err}
 	}
 
-	config, err := LoadConfig(configPath)
+	config, err := LoadConfig(g.configPath)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error loading config: %v\n", err)
-		os.Exit(1)
+		return config, nil, &ConfigError{err}
 	}
 
 	var logger *zap.Logger
-	switch loggerType {
+	switch g.loggerType {
 	case "development":
 		logger, err = zap.NewDevelopment()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "error initializing development logger: %v\n", err)
-			os.Exit(1)
+			return config, nil, fmt.Errorf("error initializing development logger: %w", err)
 		}
 	case "production":
 		logger, err = zap.NewProduction()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "error initializing production logger: %v\n", err)
-			os.Exit(1)
+			return config, nil, fmt.Errorf("error initializing production logger: %w", err)
 		}
 	}
-	defer func() { _ = logger.Sync() }()
-
 	sugar = logger.Sugar()
+	sugar.Debugf("loaded config from %s:\n%s", g.configPath, config)
 
-	if loop {
-		for {
-			err = MirrorProvidersWithConfig(config, logger)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "error mirroring providers: %v\n", err)
-				os.Exit(1)
-			}
-			sugar.Infof("sleeping %s until next loop", waitBetweenLoops)
-			time.Sleep(waitBetweenLoops)
-		}
-	} else {
-		err = MirrorProvidersWithConfig(config, logger)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error mirroring providers: %v\n", err)
-			os.Exit(1)
+	return config, logger, nil
+}
+
+type command struct {
+	name     string
+	synopsis string
+	run      func(ctx context.Context, g *globalOptions, args []string) error
+}
+
+var commands = []command{
+	{"sync", "Mirror the configured providers into storage", runSync},
+	{"verify", "Check mirrored binaries against the catalog", runVerify},
+	{"prune", "Remove mirrored binaries that the config no longer asks for", runPrune},
+	{"list", "List what is in the mirror", runList},
+	{"serve", "Serve a filesystem mirror over HTTP(S)", runServe},
+	{"export", "Write mirrored providers to a tar.gz archive", runExport},
+	{"import", "Load providers from a tar.gz archive into storage", runImport},
+	{"import-zip", "Load locally built provider zips from a directory into storage", runImportZip},
+	{"lock", "Print .terraform.lock.hcl entries for mirrored providers", runLock},
+	{"validate", "Check the config file and report every problem in it", runValidate},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	g := &globalOptions{
+		configPath: "config.yaml",
+		loggerType: "development",
+	}
+
+	fs := flag.NewFlagSet("tfspiegel", flag.ContinueOnError)
+	g.register(fs)
+	fs.Usage = func() { printUsage(fs) }
+	err := fs.Parse(args)
+	if err != nil {
+		return exitCodeForError(&UsageError{err})
+	}
+
+	if fs.NArg() < 1 {
+		printUsage(fs)
+		return exitCodeUsage
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == fs.Arg(0) {
+			cmd = &commands[i]
 		}
 	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", fs.Arg(0))
+		printUsage(fs)
+		return exitCodeUsage
+	}
+
+	// the first SIGINT or SIGTERM cancels the context so that commands can wind down cleanly,
+	// a second one kills the process as usual because NotifyContext stops relaying after cancellation
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = cmd.run(ctx, g, fs.Args()[1:])
+	if sugar != nil {
+		_ = sugar.Sync()
+	}
+
+	var usageErr *UsageError
+	if err != nil && !errors.Is(err, flag.ErrHelp) && !errors.As(err, &usageErr) {
+		fmt.Fprintf(os.Stderr, "error running %s: %v\n", cmd.name, err)
+	}
+	return exitCodeForError(err)
+}
+
+func printUsage(fs *flag.FlagSet) {
+	out := fs.Output()
+	fmt.Fprintf(out, "Usage: tfspiegel [global flags] <command> [flags]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-10s %s\n", c.name, c.synopsis)
+	}
+	fmt.Fprintf(out, "\nGlobal flags:\n")
+	fs.PrintDefaults()
+	fmt.Fprintf(out, "\nRun 'tfspiegel <command> -h' for command-specific flags.\n")
+}
+
+// builds the flag set for a command, with the global options registered on it as well
+func newCommandFlagSet(g *globalOptions, name string, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	g.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: tfspiegel %s\n\nFlags:\n", usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func parseCommandFlags(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	if err != nil {
+		return &UsageError{err}
+	}
+	if fs.NArg() > 0 {
+		err = fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+		fmt.Fprintf(fs.Output(), "%v\n", err)
+		fs.Usage()
+		return &UsageError{err}
+	}
+	return nil
 }
 
 func LoadConfig(configPath string) (config Configuration, err error) {
-	var configRaw configRaw
-	configData, err := os.ReadFile(configPath)
+	files, err := readConfigFiles(configPath)
 	if err != nil {
 		return config, err
 	}
-	err = yaml.Unmarshal(configData, &configRaw)
+	return parseConfigFiles(files)
+}
+
+// decodes and validates a config that is all in one document
+func parseConfig(configData []byte) (config Configuration, err error) {
+	return parseConfigFiles([]configFile{{data: configData}})
+}
+
+// decodes, merges and validates the files of a config. Everything that is wrong with it is reported, one error
+// per line, so that the validate command and a failing sync can list all of it at once.
+func parseConfigFiles(files []configFile) (config Configuration, err error) {
+	configRaw, errs := mergeConfigFiles(files)
+
+	secrets, err := interpolateConfig(&configRaw)
 	if err != nil {
-		return config, err
+		errs = append(errs, err)
 	}
 
 	var storageType ProviderStorageType
-	switch x := strings.ToLower(configRaw.StorageType); x {
+	switch strings.ToLower(configRaw.StorageType) {
 	case "s3":
 		storageType = STORAGE_TYPE_S3
+		if configRaw.S3Config.Bucket == "" {
+			errs = append(errs, fmt.Errorf("s3_config bucket is required with s3 storage"))
+		}
 	case "fs":
 		storageType = STORAGE_TYPE_FS
+		if configRaw.FSConfig.DownloadRoot == "" {
+			errs = append(errs, fmt.Errorf("fs_config download_root is required with fs storage"))
+		}
 	default:
-		return config, fmt.Errorf("%s is not a known storage type", x)
+		// values can come from the environment or from files, so they are left out of errors, which get logged
+		errs = append(errs, fmt.Errorf("storage_type is not a known storage type, expected fs or s3"))
+	}
+
+	for name, set := range configRaw.PlatformSets {
+		if strings.ContainsAny(name, "_*") || name == "all" {
+			errs = append(errs, fmt.Errorf("platform set name %q cannot contain _ or * or be all", name))
+		}
+		for _, platform := range set {
+			if platform.Arch != "" {
+				errs = append(errs, validatePlatform(platform, "platform set "+name))
+			}
+		}
+	}
+	// each provider knows which keys its stanza sets, so that defaults only fill in the ones it leaves out
+	applyProviderDefaults(configRaw.Providers, configRaw.Defaults)
+
+	_, err = expandPlatformSets(configRaw.Defaults.OSArchs, configRaw.PlatformSets)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("defaults: %w", err))
+	}
+	for i := range configRaw.Providers {
+		configRaw.Providers[i].OSArchs, err = expandPlatformSets(configRaw.Providers[i].OSArchs, configRaw.PlatformSets)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("provider %s: %w", configRaw.Providers[i].Reference, err))
+		}
 	}
 
 	config = Configuration{
@@ -109,135 +242,360 @@ func LoadConfig(configPath string) (config Configuration, err error) {
 			FSConfig: configRaw.FSConfig,
 			S3Config: configRaw.S3Config,
 		},
+		DefaultProviderHostname: configRaw.DefaultProviderHostname,
+		Upstreams:               configRaw.Upstreams,
+		Credentials:             configRaw.Credentials,
+		Notifications:           configRaw.Notifications,
+		RegistryCache:           configRaw.RegistryCache,
+		Strict:                  configRaw.Strict,
+		secrets:                 secrets,
 	}
 
-	return config, nil
+	errs = append(errs, ValidateConfig(config))
+	config.Providers = mergeProviderStanzas(config, config.Providers)
+	return config, errors.Join(errs...)
 }
 
-func MirrorProvidersWithConfig(config Configuration, logger *zap.Logger) error {
-	// loop through all requested provider mirror stanzas in the config and mirror each provider set one at a time
-	for _, configProvider := range config.Providers {
-		provider, err := NewProviderFromConfigProvider(configProvider.Reference)
+// catches mistakes in the provider stanzas up front instead of on every sync, returning all of them joined
+func ValidateConfig(config Configuration) error {
+	var errs []error
+	if strings.ContainsAny(config.DefaultProviderHostname, "/ ") {
+		errs = append(errs, fmt.Errorf("default_provider_hostname %q must be a bare hostname", config.DefaultProviderHostname))
+	}
+	declared := make(map[string]ProviderMirrorConfiguration)
+	for i, configProvider := range config.Providers {
+		name := configProvider.Reference
+		if configProvider.Reference == "" {
+			name = fmt.Sprintf("%d", i)
+			errs = append(errs, fmt.Errorf("provider %d has no reference", i))
+		} else if provider, err := config.NewProvider(configProvider.Reference); err != nil {
+			errs = append(errs, fmt.Errorf("provider %s: %w", name, err))
+		} else if provider.Hostname == "" || provider.Owner == "" || provider.Name == "" || strings.ContainsAny(configProvider.Reference, " \t") {
+			errs = append(errs, fmt.Errorf("provider reference %q is not of the form NAME, NAMESPACE/NAME or HOSTNAME/NAMESPACE/NAME", configProvider.Reference))
+		} else if previous, found := declared[provider.String()]; found {
+			// the stanzas are merged and synced together, see mergeProviderStanzas
+			conflicts := conflictingStanzaSettings(previous, configProvider)
+			if len(conflicts) > 0 {
+				errs = append(errs, fmt.Errorf("provider %s is declared in %s and again in %s with different %s, which stanzas for the same provider must agree on", provider, previous.source, configProvider.source, strings.Join(conflicts, ", ")))
+			}
+		} else {
+			declared[provider.String()] = configProvider
+		}
+		_, err := semver.ParseRange(configProvider.VersionRange)
 		if err != nil {
-			sugar.Errorf("error creating provider for %#v: %v", configProvider, err)
-			continue
+			errs = append(errs, fmt.Errorf("provider %s has an invalid version range %q: %w", name, configProvider.VersionRange, err))
+		}
+		for _, version := range configProvider.SkipVersions {
+			_, err = semver.Parse(version)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("provider %s has an invalid version %q in skip_versions: %w", name, version, err))
+			}
+		}
+		for _, platform := range configProvider.OSArchs {
+			errs = append(errs, validatePlatform(platform, "provider "+name))
 		}
-		providerMetadata, err := provider.GetProviderMetadataFromRegistry()
+		if _, ok := config.Upstreams[configProvider.Upstream]; configProvider.Upstream != "" && !ok {
+			errs = append(errs, fmt.Errorf("provider %s uses upstream %q, which is not defined", name, configProvider.Upstream))
+		}
+		err = configProvider.Keep.validate()
 		if err != nil {
-			sugar.Errorf("error getting metadata from remote registry for provider %s: %v", provider, err)
-			continue
+			errs = append(errs, fmt.Errorf("provider %s: %w", name, err))
 		}
-
-		osarchs := configProvider.OSArchs
-		if len(osarchs) < 1 {
-			osarchs = []HCTFProviderPlatform{{runtime.GOOS, runtime.GOARCH}}
-			sugar.Warnf("provider %s does not have OS/archs set, using current platform (%s/%s) as defaults", provider, runtime.GOOS, runtime.GOARCH)
+		if config.Strict && len(configProvider.OSArchs) == 0 {
+			errs = append(errs, fmt.Errorf("provider %s has no os_archs and there are none in defaults, which strict mode requires", name))
 		}
-
-		wantedProviderVersionedInstances, err := provider.FilterToWantedPVIs(providerMetadata, configProvider, osarchs)
+		err = configProvider.Verification.validate()
 		if err != nil {
-			sugar.Errorf("error fetching wanted provider version instances for provider %s: %v", provider, err)
-			continue
+			errs = append(errs, fmt.Errorf("provider %s: %w", name, err))
+		}
+		if configProvider.Retry.MaxAttempts < 0 || configProvider.Retry.Backoff < 0 {
+			errs = append(errs, fmt.Errorf("provider %s: retry settings cannot be negative", name))
+		}
+		if configProvider.MinAge < 0 {
+			errs = append(errs, fmt.Errorf("provider %s has a negative min_age", name))
+		}
+		if configProvider.Keep.ReleasedWithinDays > 0 && configProvider.Upstream != "" {
+			errs = append(errs, fmt.Errorf("provider %s: released_within_days needs publish dates from a registry, which upstream %s does not have", name, configProvider.Upstream))
+		}
+	}
+	if config.DownloadDestination.Type == STORAGE_TYPE_FS && !StringInSlice(config.DownloadDestination.FSConfig.Layout, []string{"", fsLayoutNetworkMirror, fsLayoutPacked, fsLayoutUnpacked}) {
+		errs = append(errs, fmt.Errorf("fs_config layout is not one of %s, %s or %s", fsLayoutNetworkMirror, fsLayoutPacked, fsLayoutUnpacked))
+	}
+	for name, upstream := range config.Upstreams {
+		if upstream.Type != upstreamTypeNetworkMirror {
+			errs = append(errs, fmt.Errorf("upstreams.%s.type is not a known upstream type, expected %s", name, upstreamTypeNetworkMirror))
+		}
+		u, err := url.Parse(upstream.URL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			// the url can carry credentials, so it is not repeated
+			errs = append(errs, fmt.Errorf("upstreams.%s.url is not an absolute url", name))
 		}
+	}
+	errs = append(errs, validateNotificationsConfig(config.Notifications))
+	return errors.Join(errs...)
+}
 
-		var pvisToDownload []ProviderSpecificInstance
-		var d ProviderDownloader
+func MirrorProvidersWithConfig(ctx context.Context, config Configuration, logger *zap.Logger, opts SyncOptions) (err error) {
+	failed := 0
+	var providerErrs []error
 
-		switch config.DownloadDestination.Type {
-		case STORAGE_TYPE_FS:
-			d = ProviderDownloader{
-				Storage: FSProviderStorageConfiguration{
-					downloadRoot:            config.DownloadDestination.FSConfig.DownloadRoot,
-					provider:                provider,
-					sugar:                   sugar,
-					wantedProviderInstances: wantedProviderVersionedInstances,
-				},
-			}
-		case STORAGE_TYPE_S3:
-			ctx := context.Background()
-			awscfg, err := awsconfig.LoadDefaultConfig(ctx)
-			if err != nil {
-				return err
+	report := RunReport{
+		Mode:      syncModeName(opts),
+		StartedAt: time.Now(),
+		Providers: []ProviderReport{},
+	}
+	if opts.ReportPath != "" {
+		// written however the pass ends, including when it is interrupted
+		defer func() {
+			report.FinishedAt = time.Now()
+			report.DurationSeconds = report.FinishedAt.Sub(report.StartedAt).Seconds()
+			report.Interrupted = ctx.Err() != nil
+			reportErr := writeRunReport(opts.ReportPath, report)
+			if reportErr != nil {
+				sugar.Errorf("error writing run report to %s: %v", opts.ReportPath, reportErr)
+				if err == nil {
+					err = fmt.Errorf("error writing run report: %w", reportErr)
+				}
 			}
-			prefix := config.DownloadDestination.S3Config.Prefix
-
-			var s3opts []func(*awss3.Options)
-			if config.DownloadDestination.S3Config.Endpoint != "" {
-				const defaultRegion = "us-east-1"
-				awscfg.Region = defaultRegion
-				endpoint := config.DownloadDestination.S3Config.Endpoint
-				s3opts = append(s3opts, func(o *awss3.Options) {
-					o.BaseEndpoint = aws.String(endpoint)
-					o.UsePathStyle = true
-				})
+		}()
+	}
+
+	registryResponses.configure(config.RegistryCache)
+
+	// storage gets a little longer than everything else when shutting down so that
+	// uploads in progress can finish and catalogs are written for what was mirrored
+	storageCtx, cancel := withGracePeriod(ctx, storageShutdownGracePeriod)
+	defer cancel()
+
+	// loop through all requested provider mirror stanzas in the config and mirror each provider set one at a time
+	for _, configProvider := range config.Providers {
+		if ctx.Err() != nil {
+			sugar.Warnf("stopping sync: %v", ctx.Err())
+			return ctx.Err()
+		}
+		syncHealth.progress()
+		name := configProvider.Reference
+		if provider, err := config.NewProvider(configProvider.Reference); err == nil {
+			name = provider.String()
+		}
+		providerReport := newProviderReport(configProvider)
+		providerReport.Provider = name
+		providerReport.StartedAt = time.Now()
+		err := mirrorProviderWithConfig(ctx, storageCtx, config, configProvider, opts, &providerReport)
+		providerReport.DurationSeconds = time.Since(providerReport.StartedAt).Seconds()
+		if err != nil {
+			providerReport.Status = reportStatusFailed
+			if ctx.Err() != nil {
+				providerReport.Status = reportStatusInterrupted
 			}
-			s3client := awss3.NewFromConfig(awscfg, s3opts...)
-
-			d = ProviderDownloader{
-				Storage: S3ProviderStorageConfiguration{
-					bucket:                  config.DownloadDestination.S3Config.Bucket,
-					context:                 ctx,
-					prefix:                  prefix,
-					provider:                provider,
-					s3client:                *s3client,
-					sugar:                   sugar,
-					wantedProviderInstances: wantedProviderVersionedInstances,
-				},
+			providerReport.Error = err.Error()
+		}
+		report.add(providerReport)
+		if err != nil {
+			sugar.Errorf("%v", err)
+			failed++
+			providerErrs = append(providerErrs, err)
+			// being interrupted by a shutdown is not worth telling anyone about
+			if ctx.Err() == nil {
+				syncNotifier.notify(ctx, config.Notifications, newSyncFailureNotification(name, err))
 			}
+		} else {
+			syncNotifier.resolve(notifySyncFailure, name)
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if failed > 0 {
+		return &ProviderFailuresError{Failed: failed, Total: len(config.Providers), Errors: providerErrs}
+	}
+	return nil
+}
+
+// records when the wanted versions were released or first seen and drops the versions that are younger than
+// min_age from toDownload, listing them in the report
+func holdBackPendingVersions(ctx context.Context, storage ProviderStorer, source ProviderSource, provider Provider, configProvider ProviderMirrorConfiguration, wanted []ProviderSpecificInstance, toDownload []ProviderSpecificInstance, catalog []ProviderSpecificInstanceBinary, report *ProviderReport) ([]ProviderSpecificInstance, error) {
+	firstSeen, err := storage.LoadFirstSeen()
+	if err != nil {
+		return nil, fmt.Errorf("error loading first seen times for provider %s: %w", provider, err)
+	}
+	now := time.Now().UTC()
+	released, err := releaseDates(ctx, source, provider, toDownload, firstSeen, configProvider.MinAge, now)
+	if err != nil {
+		return nil, err
+	}
+	if recordFirstSeen(firstSeen, wanted, catalog, released, now) {
+		err = storage.StoreFirstSeen(firstSeen)
+		if err != nil {
+			return nil, fmt.Errorf("error storing first seen times for provider %s: %w", provider, err)
 		}
-		catalogContents, err := d.Storage.LoadCatalog()
-		var valid []ProviderSpecificInstanceBinary
-		var invalid []ProviderSpecificInstanceBinary
+	}
+
+	ready, pending := holdBackYoungVersions(toDownload, firstSeen, configProvider.MinAge, now)
+	for _, version := range pending {
+		sugar.Infof("holding back %s %s until %s, its age counts from %s", provider, version.Version, version.ReadyAt.Format(time.RFC3339), version.FirstSeen.Format(time.RFC3339))
+	}
+	report.Pending = append(report.Pending, pending...)
+	return ready, nil
+}
+
+// mirrors a provider with the stanzas merged into its config, recording what happened to each instance in report
+func mirrorProviderWithConfig(ctx context.Context, storageCtx context.Context, config Configuration, configProvider ProviderMirrorConfiguration, opts SyncOptions, report *ProviderReport) error {
+	provider, err := config.NewProvider(configProvider.Reference)
+	if err != nil {
+		return fmt.Errorf("error creating provider for %#v: %w", configProvider, err)
+	}
+
+	start := time.Now()
+	defer func() {
+		metricSyncDuration.WithLabelValues(provider.String()).Observe(time.Since(start).Seconds())
+	}()
+
+	source, err := newProviderSource(config, configProvider, provider)
+	if err != nil {
+		return fmt.Errorf("error setting up upstream for provider %s: %w", provider, err)
+	}
+	providerMetadata, err := source.GetProviderMetadata(ctx, provider, configProvider.upstreamQuery())
+	if err != nil {
+		return fmt.Errorf("error getting metadata from upstream for provider %s: %w", provider, err)
+	}
+
+	report.UnparseableVersions = unparseableVersions(providerMetadata)
+	wantedProviderVersionedInstances, err := provider.wantedInstances(providerMetadata, configProvider)
+	if err != nil {
+		return fmt.Errorf("error fetching wanted provider version instances for provider %s: %w", provider, err)
+	}
+
+	var pvisToDownload []ProviderSpecificInstance
+
+	storage, err := NewProviderStorer(storageCtx, config.DownloadDestination, provider, wantedProviderVersionedInstances)
+	if err != nil {
+		return fmt.Errorf("error setting up storage for provider %s: %w", provider, err)
+	}
+	d := ProviderDownloader{Storage: storage, Source: source, Retry: configProvider.Retry, Verification: configProvider.Verification}
+
+	catalogContents, err := d.Storage.LoadCatalog()
+	var valid []ProviderSpecificInstanceBinary
+	var invalid []ProviderSpecificInstanceBinary
 
+	if err != nil {
+		sugar.Errorf("error loading catalog for provider %s: %v", provider, err)
+		sugar.Infof("initializing provider %s as fresh", provider)
+		pvisToDownload = wantedProviderVersionedInstances
+	} else if opts.NewVersionsOnly || configProvider.Verification.Storage == verifyStorageCatalog {
+		sugar.Infof("trusting catalog for provider %s without verifying it against storage", provider)
+		valid = catalogContents
+		pvisToDownload = d.Storage.ReconcileWantedProviderInstances(valid, nil, wantedProviderVersionedInstances)
+	} else {
+		valid, invalid, err = d.Storage.VerifyCatalogAgainstStorage(catalogContents)
 		if err != nil {
-			sugar.Errorf("error loading catalog for provider %s: %v", provider, err)
+			sugar.Errorf("error verifying catalog against storage for provider %s: %v", provider, err)
 			sugar.Infof("initializing provider %s as fresh", provider)
 			pvisToDownload = wantedProviderVersionedInstances
 		} else {
-			valid, invalid, err = d.Storage.VerifyCatalogAgainstStorage(catalogContents)
-			if err != nil {
-				sugar.Errorf("error verifying catalog against storage for provider %s: %v", provider, err)
-				sugar.Infof("initializing provider %s as fresh", provider)
-				pvisToDownload = wantedProviderVersionedInstances
-			} else {
-				pvisToDownload = d.Storage.ReconcileWantedProviderInstances(valid, invalid, wantedProviderVersionedInstances)
+			if len(invalid) > 0 {
+				syncNotifier.notify(ctx, config.Notifications, newIntegrityNotification(provider.String(), invalid))
 			}
+			pvisToDownload = d.Storage.ReconcileWantedProviderInstances(valid, invalid, wantedProviderVersionedInstances)
 		}
+	}
 
-		marshalled, err := json.MarshalIndent(pvisToDownload, "", "  ")
+	if configProvider.MinAge > 0 {
+		pvisToDownload, err = holdBackPendingVersions(ctx, d.Storage, source, provider, configProvider, wantedProviderVersionedInstances, pvisToDownload, catalogContents, report)
 		if err != nil {
-			sugar.Errorf("error marshalling provider instances to download for provider %s: %v", provider, err)
-			continue
-		}
-		if len(pvisToDownload) > 0 {
-			sugar.Debugf("%s\n", marshalled)
+			return err
 		}
+	}
+
+	marshalled, err := json.MarshalIndent(pvisToDownload, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling provider instances to download for provider %s: %w", provider, err)
+	}
+	if len(pvisToDownload) > 0 {
+		sugar.Debugf("%s\n", marshalled)
+	}
 
-		var psibs []ProviderSpecificInstanceBinary
-		psibs = append(psibs, valid...)
+	var psibs []ProviderSpecificInstanceBinary
+	psibs = append(psibs, valid...)
+	for _, psib := range valid {
+		report.Skipped = append(report.Skipped, newReportInstanceFromBinary(psib))
+	}
+	wasInvalid := map[ProviderSpecificInstance]bool{}
+	for _, psib := range invalid {
+		wasInvalid[psib.ProviderSpecificInstance] = true
+	}
 
-		// we need to record failed downloads as well so that we can exclude that entire version from the catalog,
-		// in instances where some particular OS+arch combo of a provider fails to download for some reason
-		failedPvis := []ProviderSpecificInstance{}
+	// we need to record failed downloads as well so that we can exclude that entire version from the catalog,
+	// in instances where some particular OS+arch combo of a provider fails to download for some reason
+	failedPvis := []ProviderSpecificInstance{}
+	var failures []InstanceFailure
 
-		for _, pvi := range pvisToDownload {
-			psib, err := d.MirrorProviderInstanceToDest(pvi)
-			if err != nil {
-				sugar.Errorf("error mirroring provider instance %s: %v", pvi, err)
-				failedPvis = append(failedPvis, pvi)
-				continue
+	for i, pvi := range pvisToDownload {
+		// when shutting down, whatever has not been mirrored yet counts as failed so that
+		// the catalog written below only lists complete versions
+		if ctx.Err() != nil {
+			for _, remaining := range pvisToDownload[i:] {
+				failedPvis = append(failedPvis, remaining)
+				failures = append(failures, InstanceFailure{Instance: remaining, Err: ctx.Err()})
+				failed := newReportInstance(remaining)
+				failed.Error = ctx.Err().Error()
+				report.Failed = append(report.Failed, failed)
 			}
-			psibs = append(psibs, *psib)
+			break
 		}
-
-		finalPsibs := FilterVersionsWithFailedPSIBs(psibs, failedPvis)
-
-		err = d.Storage.StoreCatalog(finalPsibs)
+		syncHealth.progress()
+		psib, err := d.MirrorProviderInstanceToDest(ctx, pvi)
 		if err != nil {
-			sugar.Errorf("error writing catalog for provider %s: %v", provider, err)
+			sugar.Errorf("error mirroring provider instance %s: %v", pvi, err)
+			failedPvis = append(failedPvis, pvi)
+			failures = append(failures, InstanceFailure{Instance: pvi, Err: err})
+			failed := newReportInstance(pvi)
+			failed.Error = err.Error()
+			report.Failed = append(report.Failed, failed)
 			continue
 		}
+		report.BytesDownloaded += psib.Size
+		if wasInvalid[pvi] {
+			report.Redownloaded = append(report.Redownloaded, newReportInstanceFromBinary(*psib))
+		} else {
+			report.Mirrored = append(report.Mirrored, newReportInstanceFromBinary(*psib))
+		}
+		psibs = append(psibs, *psib)
 	}
 
+	// publish dates go into the catalog so that prune can apply released_within_days without asking the registry
+	publishedAt := make(map[string]time.Time)
+	for _, version := range providerMetadata.Versions {
+		if !version.PublishedAt.IsZero() {
+			publishedAt[version.Version] = version.PublishedAt
+		}
+	}
+	for i := range psibs {
+		if date, ok := publishedAt[psibs[i].Version]; ok {
+			psibs[i].PublishedAt = date
+		}
+	}
+
+	finalPsibs := FilterVersionsWithFailedPSIBs(psibs, failedPvis)
+	report.Excluded = excludedInstances(psibs, finalPsibs)
+
+	err = d.Storage.StoreCatalog(finalPsibs)
+	if err != nil {
+		metricCatalogWriteFailures.WithLabelValues(provider.String()).Inc()
+		return fmt.Errorf("error writing catalog for provider %s: %w", provider, err)
+	}
+
+	if notification, ok := newVersionsNotification(provider.String(), catalogContents, finalPsibs); ok {
+		syncNotifier.notify(ctx, config.Notifications, notification)
+	}
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("sync of provider %s was interrupted: %w", provider, ctx.Err())
+	}
+	if len(failures) > 0 {
+		return &InstanceFailuresError{Provider: provider.String(), Failures: failures}
+	}
+	metricLastSuccessfulSync.WithLabelValues(provider.String()).SetToCurrentTime()
 	return nil
 }
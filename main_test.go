@@ -3,7 +3,10 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -66,6 +69,267 @@ providers:
 				}
 			},
 		},
+		{
+			name: "notifications",
+			yaml: `
+storage_type: fs
+fs_config:
+  download_root: /tmp/mirror
+notifications:
+  repeat_interval: 12h
+  webhooks:
+    - url: https://hooks.slack.com/services/T0/B0/x
+      format: slack
+      events: [sync_failure, integrity]
+providers: []
+`,
+			wantErr: false,
+			checkConfig: func(t *testing.T, c Configuration) {
+				if c.Notifications.RepeatInterval != 12*time.Hour {
+					t.Errorf("unexpected repeat interval: %s", c.Notifications.RepeatInterval)
+				}
+				if len(c.Notifications.Webhooks) != 1 || c.Notifications.Webhooks[0].Format != "slack" {
+					t.Errorf("unexpected webhooks: %+v", c.Notifications.Webhooks)
+				}
+			},
+		},
+		{
+			name: "default provider hostname",
+			yaml: `
+storage_type: fs
+fs_config:
+  download_root: /tmp/mirror
+default_provider_hostname: registry.opentofu.org
+providers:
+  - reference: aws
+    version_range: ">=5.0.0"
+`,
+			wantErr: false,
+			checkConfig: func(t *testing.T, c Configuration) {
+				provider, err := c.NewProvider(c.Providers[0].Reference)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if provider.Hostname != "registry.opentofu.org" {
+					t.Errorf("unexpected hostname: %s", provider.Hostname)
+				}
+			},
+		},
+		{
+			name: "default provider hostname with a path",
+			yaml: `
+storage_type: fs
+fs_config:
+  download_root: /tmp/mirror
+default_provider_hostname: registry.opentofu.org/hashicorp
+providers: []
+`,
+			wantErr: true,
+		},
+		{
+			name: "network mirror upstream",
+			yaml: `
+storage_type: fs
+fs_config:
+  download_root: /tmp/mirror
+upstreams:
+  central:
+    type: network_mirror
+    url: https://mirror.example.com/providers/
+providers:
+  - reference: aws
+    version_range: ">=5.0.0"
+    upstream: central
+`,
+			wantErr: false,
+			checkConfig: func(t *testing.T, c Configuration) {
+				if c.Providers[0].Upstream != "central" {
+					t.Errorf("unexpected upstream: %s", c.Providers[0].Upstream)
+				}
+				if c.Upstreams["central"].URL != "https://mirror.example.com/providers/" {
+					t.Errorf("unexpected upstreams: %+v", c.Upstreams)
+				}
+			},
+		},
+		{
+			name: "undefined upstream",
+			yaml: `
+storage_type: fs
+fs_config:
+  download_root: /tmp/mirror
+providers:
+  - reference: aws
+    version_range: ">=5.0.0"
+    upstream: central
+`,
+			wantErr: true,
+		},
+		{
+			name: "unpacked fs layout",
+			yaml: `
+storage_type: fs
+fs_config:
+  download_root: /tmp/mirror
+  layout: unpacked
+providers: []
+`,
+			checkConfig: func(t *testing.T, c Configuration) {
+				if c.DownloadDestination.FSConfig.Layout != fsLayoutUnpacked {
+					t.Errorf("unexpected layout: %s", c.DownloadDestination.FSConfig.Layout)
+				}
+			},
+		},
+		{
+			name: "min age",
+			yaml: `
+storage_type: fs
+fs_config:
+  download_root: /tmp/mirror
+providers:
+  - reference: aws
+    version_range: ">=5.0.0"
+    min_age: 168h
+`,
+			checkConfig: func(t *testing.T, c Configuration) {
+				if c.Providers[0].MinAge != 7*24*time.Hour {
+					t.Errorf("unexpected min_age: %s", c.Providers[0].MinAge)
+				}
+			},
+		},
+		{
+			name: "platform sets and wildcards",
+			yaml: `
+storage_type: fs
+fs_config:
+  download_root: /tmp/mirror
+platform_sets:
+  workstations: [darwin_arm64, darwin_amd64, windows_amd64]
+providers:
+  - reference: aws
+    version_range: ">=5.0.0"
+    os_archs: [workstations, "linux_*"]
+`,
+			checkConfig: func(t *testing.T, c Configuration) {
+				want := []HCTFProviderPlatform{{OS: "darwin", Arch: "arm64"}, {OS: "darwin", Arch: "amd64"}, {OS: "windows", Arch: "amd64"}, {OS: "linux", Arch: "*"}}
+				if !reflect.DeepEqual(c.Providers[0].OSArchs, want) {
+					t.Errorf("unexpected os_archs: %+v", c.Providers[0].OSArchs)
+				}
+			},
+		},
+		{
+			name: "unknown platform set",
+			yaml: `
+storage_type: fs
+fs_config:
+  download_root: /tmp/mirror
+providers:
+  - reference: aws
+    version_range: ">=5.0.0"
+    os_archs: [servers]
+`,
+			wantErr: true,
+		},
+		{
+			name: "defaults",
+			yaml: `
+storage_type: fs
+fs_config:
+  download_root: /tmp/mirror
+strict: true
+platform_sets:
+  workstations: [darwin_arm64, windows_amd64]
+defaults:
+  os_archs: [workstations]
+  min_age: 48h
+  verification:
+    storage: catalog
+providers:
+  - reference: aws
+    version_range: ">=5.0.0"
+  - reference: random
+    version_range: ">=3.0.0"
+    os_archs: [linux_amd64]
+`,
+			checkConfig: func(t *testing.T, c Configuration) {
+				want := []HCTFProviderPlatform{{OS: "darwin", Arch: "arm64"}, {OS: "windows", Arch: "amd64"}}
+				if !reflect.DeepEqual(c.Providers[0].OSArchs, want) {
+					t.Errorf("unexpected os_archs: %+v", c.Providers[0].OSArchs)
+				}
+				if c.Providers[1].OSArchs[0] != (HCTFProviderPlatform{OS: "linux", Arch: "amd64"}) {
+					t.Errorf("unexpected os_archs: %+v", c.Providers[1].OSArchs)
+				}
+				if c.Providers[1].MinAge != 48*time.Hour || c.Providers[1].Verification.Storage != verifyStorageCatalog {
+					t.Errorf("defaults not applied: %+v", c.Providers[1])
+				}
+			},
+		},
+		{
+			name: "strict without platforms",
+			yaml: `
+storage_type: fs
+fs_config:
+  download_root: /tmp/mirror
+strict: true
+providers:
+  - reference: aws
+    version_range: ">=5.0.0"
+`,
+			wantErr: true,
+		},
+		{
+			name: "unknown verification policy",
+			yaml: `
+storage_type: fs
+fs_config:
+  download_root: /tmp/mirror
+defaults:
+  verification:
+    storage: sometimes
+providers:
+  - reference: aws
+    version_range: ">=5.0.0"
+`,
+			wantErr: true,
+		},
+		{
+			name: "unknown fs layout",
+			yaml: `
+storage_type: fs
+fs_config:
+  download_root: /tmp/mirror
+  layout: flat
+providers: []
+`,
+			wantErr: true,
+		},
+		{
+			name: "upstream with unknown type",
+			yaml: `
+storage_type: fs
+fs_config:
+  download_root: /tmp/mirror
+upstreams:
+  central:
+    type: artifactory
+    url: https://mirror.example.com/
+providers: []
+`,
+			wantErr: true,
+		},
+		{
+			name: "webhook with unknown event",
+			yaml: `
+storage_type: fs
+fs_config:
+  download_root: /tmp/mirror
+notifications:
+  webhooks:
+    - url: https://example.com/hook
+      events: [everything]
+providers: []
+`,
+			wantErr: true,
+		},
 		{
 			name: "case insensitive storage type",
 			yaml: `
@@ -158,3 +422,36 @@ func TestLoadConfigMissingFile(t *testing.T) {
 		t.Fatal("expected error for missing file, got nil")
 	}
 }
+
+func TestParseConfigReportsEveryProblem(t *testing.T) {
+	_, err := parseConfig([]byte(`
+storage_type: s3
+providers:
+  - reference: aws
+    version_rnage: ">=5.0.0"
+    skip_versions: [5.1]
+    os_archs: [linux_amd46]
+  - reference: hashicorp//google
+    version_range: "=> 1"
+    os_archs:
+      - os: linux
+        arch: amd64
+        variant: musl
+`))
+	if err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	for _, want := range []string{
+		"line 5: field version_rnage not found",
+		"line 13: field variant not found",
+		"s3_config bucket is required",
+		`invalid version "5.1" in skip_versions`,
+		`unknown arch "amd46"`,
+		`provider reference "hashicorp//google" is not of the form`,
+		`invalid version range "=> 1"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q:\n%v", want, err)
+		}
+	}
+}
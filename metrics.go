@@ -0,0 +1,63 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// metrics are registered with the default Prometheus registry and served on /metrics when sync is given a listen address
+var (
+	metricDownloadsAttempted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tfspiegel_downloads_attempted_total",
+		Help: "Provider instances that a download was attempted for.",
+	}, []string{"provider", "platform"})
+	metricDownloadsSucceeded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tfspiegel_downloads_succeeded_total",
+		Help: "Provider instances that were downloaded and written to storage.",
+	}, []string{"provider", "platform"})
+	metricDownloadsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tfspiegel_downloads_failed_total",
+		Help: "Provider instances that could not be mirrored after all retries.",
+	}, []string{"provider", "platform"})
+	metricDownloadRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tfspiegel_download_retries_total",
+		Help: "Retries made while mirroring provider instances.",
+	}, []string{"provider", "platform"})
+	metricChecksumMismatches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tfspiegel_checksum_mismatches_total",
+		Help: "Downloaded binaries whose SHA256 did not match the registry.",
+	}, []string{"provider", "platform"})
+	metricBytesDownloaded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tfspiegel_downloaded_bytes_total",
+		Help: "Bytes of provider binaries downloaded.",
+	}, []string{"provider"})
+	metricRegistryCache = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tfspiegel_registry_cache_requests_total",
+		Help: "Registry and upstream mirror requests by how the cache answered them: hit, revalidated or miss.",
+	}, []string{"result"})
+	metricCatalogWriteFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tfspiegel_catalog_write_failures_total",
+		Help: "Failed attempts to write a provider catalog to storage.",
+	}, []string{"provider"})
+	metricLastSuccessfulSync = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tfspiegel_last_successful_sync_timestamp_seconds",
+		Help: "Unix time of the last sync of a provider that finished without errors.",
+	}, []string{"provider"})
+	metricConfigReloads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tfspiegel_config_reloads_total",
+		Help: "Attempts to reload the config file while watching, by result (success or failure).",
+	}, []string{"result"})
+	metricNotifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tfspiegel_notifications_total",
+		Help: "Webhook notifications by event and result (success, failure or suppressed as a repeat).",
+	}, []string{"event", "result"})
+	metricNextSync = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tfspiegel_next_sync_timestamp_seconds",
+		Help: "Unix time of the next scheduled sync, by mode (full or new_versions).",
+	}, []string{"mode"})
+	metricSyncDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tfspiegel_sync_duration_seconds",
+		Help:    "Time taken to sync a provider.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 14),
+	}, []string{"provider"})
+)
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	notifySyncFailure = "sync_failure"
+	notifyNewVersions = "new_versions"
+	notifyIntegrity   = "integrity"
+)
+
+var notificationEvents = []string{notifySyncFailure, notifyNewVersions, notifyIntegrity}
+
+// what a webhook with format json receives
+type Notification struct {
+	Event    string             `json:"event"`
+	Provider string             `json:"provider"`
+	Message  string             `json:"message"`
+	Items    []NotificationItem `json:"items,omitempty"`
+	Time     time.Time          `json:"time"`
+}
+
+// a single provider instance that a notification is about
+type NotificationItem struct {
+	Version  string `json:"version"`
+	Platform string `json:"platform,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// identifies notifications that are about the same instances; the message, the error texts and the time are
+// left out, since errors often carry request IDs or addresses that change on every attempt
+func (n Notification) key() string {
+	instances := make([]string, 0, len(n.Items))
+	for _, item := range n.Items {
+		instances = append(instances, item.Version+" "+item.Platform)
+	}
+	sort.Strings(instances)
+	return n.Event + "\x00" + n.Provider + "\x00" + strings.Join(slices.Compact(instances), "\x00")
+}
+
+func (n Notification) slackText() string {
+	var b strings.Builder
+	switch n.Event {
+	case notifySyncFailure:
+		fmt.Fprintf(&b, ":x: *sync failed* for `%s`: %s", n.Provider, n.Message)
+	case notifyNewVersions:
+		fmt.Fprintf(&b, ":package: *new versions mirrored* for `%s`: %s", n.Provider, n.Message)
+	case notifyIntegrity:
+		fmt.Fprintf(&b, ":warning: *integrity problem* for `%s`: %s", n.Provider, n.Message)
+	}
+	for _, item := range n.Items {
+		fmt.Fprintf(&b, "\n• %s", item.Version)
+		if item.Platform != "" {
+			fmt.Fprintf(&b, " %s", item.Platform)
+		}
+		if item.Error != "" {
+			fmt.Fprintf(&b, ": %s", item.Error)
+		}
+	}
+	return b.String()
+}
+
+// sends notifications to the configured webhooks, dropping any that repeat one already sent within the repeat interval
+type notifier struct {
+	mu   sync.Mutex
+	sent map[string]time.Time
+	now  func() time.Time
+}
+
+// like syncHealth this lives at package level, so that what was already sent is remembered across sync loops and config reloads
+var syncNotifier = newNotifier()
+
+func newNotifier() *notifier {
+	return &notifier{
+		sent: map[string]time.Time{},
+		now:  time.Now,
+	}
+}
+
+func (n *notifier) notify(ctx context.Context, config notificationsConfig, notification Notification) {
+	if len(config.Webhooks) == 0 {
+		return
+	}
+
+	repeatInterval := config.RepeatInterval
+	if repeatInterval == 0 {
+		repeatInterval = defaultNotificationRepeatInterval
+	}
+
+	now := n.now()
+	key := notification.key()
+	n.mu.Lock()
+	last, seen := n.sent[key]
+	if seen && now.Sub(last) < repeatInterval {
+		n.mu.Unlock()
+		sugar.Debugf("not repeating %s notification for provider %s, last sent at %s", notification.Event, notification.Provider, last.Format(time.RFC3339))
+		metricNotifications.WithLabelValues(notification.Event, "suppressed").Inc()
+		return
+	}
+	n.sent[key] = now
+	n.mu.Unlock()
+
+	notification.Time = now
+	for _, webhook := range config.Webhooks {
+		if len(webhook.Events) > 0 && !StringInSlice(notification.Event, webhook.Events) {
+			continue
+		}
+		err := sendWebhook(ctx, webhook, notification)
+		if err != nil {
+			// the URL is left out because webhook URLs usually carry a secret
+			sugar.Errorf("error sending %s notification for provider %s: %v", notification.Event, notification.Provider, err)
+			metricNotifications.WithLabelValues(notification.Event, "failure").Inc()
+			continue
+		}
+		metricNotifications.WithLabelValues(notification.Event, "success").Inc()
+	}
+}
+
+// forgets what was sent for a provider and event, so that the next problem is reported straight away
+// instead of being held back because an identical one was reported before the provider recovered
+func (n *notifier) resolve(event string, provider string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	prefix := event + "\x00" + provider + "\x00"
+	for key := range n.sent {
+		if strings.HasPrefix(key, prefix) {
+			delete(n.sent, key)
+		}
+	}
+}
+
+func sendWebhook(ctx context.Context, webhook webhookConfig, notification Notification) error {
+	var payload any = notification
+	if webhook.Format == "slack" {
+		payload = map[string]string{"text": notification.slackText()}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	// notifications about an interrupted sync should still go out, so this does not inherit the cancellation
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), notificationTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range webhook.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		// the error from the client includes the URL, which is dropped for the same reason
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %s", resp.Status)
+	}
+	return nil
+}
+
+func newSyncFailureNotification(provider string, err error) Notification {
+	notification := Notification{
+		Event:    notifySyncFailure,
+		Provider: provider,
+		Message:  err.Error(),
+	}
+	var failures *InstanceFailuresError
+	if errors.As(err, &failures) {
+		for _, failure := range failures.Failures {
+			notification.Items = append(notification.Items, NotificationItem{
+				Version:  failure.Instance.Version,
+				Platform: failure.Instance.OS + "_" + failure.Instance.Arch,
+				Error:    failure.Err.Error(),
+			})
+		}
+	}
+	return notification
+}
+
+// reports the versions that are in the new catalog but were not in the old one
+func newVersionsNotification(provider string, previous []ProviderSpecificInstanceBinary, current []ProviderSpecificInstanceBinary) (Notification, bool) {
+	known := map[string]bool{}
+	for _, psib := range previous {
+		known[psib.Version] = true
+	}
+	platforms := map[string][]string{}
+	for _, psib := range current {
+		if !known[psib.Version] {
+			platforms[psib.Version] = append(platforms[psib.Version], psib.OS+"_"+psib.Arch)
+		}
+	}
+	if len(platforms) == 0 {
+		return Notification{}, false
+	}
+
+	var versions []string
+	for version := range platforms {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	notification := Notification{
+		Event:    notifyNewVersions,
+		Provider: provider,
+		Message:  fmt.Sprintf("mirrored %d new versions: %s", len(versions), strings.Join(versions, ", ")),
+	}
+	for _, version := range versions {
+		sort.Strings(platforms[version])
+		notification.Items = append(notification.Items, NotificationItem{
+			Version:  version,
+			Platform: strings.Join(platforms[version], ", "),
+		})
+	}
+	return notification, true
+}
+
+func newIntegrityNotification(provider string, invalid []ProviderSpecificInstanceBinary) Notification {
+	notification := Notification{
+		Event:    notifyIntegrity,
+		Provider: provider,
+		Message:  fmt.Sprintf("%d mirrored binaries are missing or do not match the catalog", len(invalid)),
+	}
+	for _, psib := range invalid {
+		notification.Items = append(notification.Items, NotificationItem{
+			Version:  psib.Version,
+			Platform: psib.OS + "_" + psib.Arch,
+			Error:    fmt.Sprintf("%s is missing or does not match %s", psib.FullPath, psib.H1Checksum),
+		})
+	}
+	return notification
+}
+
+func validateNotificationsConfig(config notificationsConfig) error {
+	var errs []error
+	if config.RepeatInterval < 0 {
+		errs = append(errs, fmt.Errorf("notifications repeat_interval must not be negative"))
+	}
+	for i, webhook := range config.Webhooks {
+		if webhook.URL == "" {
+			errs = append(errs, fmt.Errorf("webhook %d has no url", i))
+		}
+		if webhook.Format != "" && webhook.Format != "json" && webhook.Format != "slack" {
+			errs = append(errs, fmt.Errorf("webhook %d has unknown format %q, expected json or slack", i, webhook.Format))
+		}
+		for _, event := range webhook.Events {
+			if !StringInSlice(event, notificationEvents) {
+				errs = append(errs, fmt.Errorf("webhook %d has unknown event %q, expected one of %s", i, event, strings.Join(notificationEvents, ", ")))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collects the bodies posted to it
+type webhookRecorder struct {
+	mu     sync.Mutex
+	bodies []string
+	server *httptest.Server
+}
+
+func newWebhookRecorder(t *testing.T) *webhookRecorder {
+	r := &webhookRecorder{}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.bodies = append(r.bodies, string(body))
+	}))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func (r *webhookRecorder) received() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.bodies...)
+}
+
+func TestNotifierPayloads(t *testing.T) {
+	failure := &InstanceFailuresError{
+		Provider: "registry.terraform.io/hashicorp/aws",
+		Failures: []InstanceFailure{{
+			Instance: ProviderSpecificInstance{Version: "5.1.0", OS: "linux", Arch: "arm64"},
+			Err:      errors.New("checksum mismatch"),
+		}},
+	}
+	notification := newSyncFailureNotification("registry.terraform.io/hashicorp/aws", failure)
+
+	t.Run("json", func(t *testing.T) {
+		recorder := newWebhookRecorder(t)
+		n := newNotifier()
+		n.notify(context.Background(), notificationsConfig{Webhooks: []webhookConfig{{URL: recorder.server.URL}}}, notification)
+
+		bodies := recorder.received()
+		if len(bodies) != 1 {
+			t.Fatalf("got %d requests, want 1", len(bodies))
+		}
+		var got Notification
+		if err := json.Unmarshal([]byte(bodies[0]), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Event != notifySyncFailure || got.Provider != "registry.terraform.io/hashicorp/aws" {
+			t.Errorf("unexpected notification %+v", got)
+		}
+		want := NotificationItem{Version: "5.1.0", Platform: "linux_arm64", Error: "checksum mismatch"}
+		if len(got.Items) != 1 || got.Items[0] != want {
+			t.Errorf("items = %+v, want [%+v]", got.Items, want)
+		}
+		if got.Time.IsZero() {
+			t.Errorf("time was not set")
+		}
+	})
+
+	t.Run("slack", func(t *testing.T) {
+		recorder := newWebhookRecorder(t)
+		n := newNotifier()
+		n.notify(context.Background(), notificationsConfig{Webhooks: []webhookConfig{{URL: recorder.server.URL, Format: "slack"}}}, notification)
+
+		bodies := recorder.received()
+		if len(bodies) != 1 {
+			t.Fatalf("got %d requests, want 1", len(bodies))
+		}
+		var got map[string]string
+		if err := json.Unmarshal([]byte(bodies[0]), &got); err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{"sync failed", "hashicorp/aws", "5.1.0 linux_arm64: checksum mismatch"} {
+			if !strings.Contains(got["text"], want) {
+				t.Errorf("slack text %q does not contain %q", got["text"], want)
+			}
+		}
+	})
+}
+
+func TestNotifierDeduplication(t *testing.T) {
+	recorder := newWebhookRecorder(t)
+	config := notificationsConfig{
+		Webhooks:       []webhookConfig{{URL: recorder.server.URL}},
+		RepeatInterval: time.Hour,
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	n := newNotifier()
+	n.now = func() time.Time { return now }
+
+	notification := newSyncFailureNotification("registry.terraform.io/hashicorp/aws", errors.New("registry unavailable"))
+	n.notify(context.Background(), config, notification)
+	now = now.Add(30 * time.Minute)
+	n.notify(context.Background(), config, notification)
+	if got := len(recorder.received()); got != 1 {
+		t.Fatalf("repeat within the interval sent %d requests, want 1", got)
+	}
+
+	other := newSyncFailureNotification("registry.terraform.io/hashicorp/aws", errors.New("registry unavailable (request id 2)"))
+	n.notify(context.Background(), config, other)
+	if got := len(recorder.received()); got != 1 {
+		t.Fatalf("the same failure with another error sent %d requests in total, want 1", got)
+	}
+
+	now = now.Add(time.Hour)
+	n.notify(context.Background(), config, notification)
+	if got := len(recorder.received()); got != 2 {
+		t.Fatalf("repeat after the interval sent %d requests in total, want 2", got)
+	}
+
+	n.resolve(notifySyncFailure, "registry.terraform.io/hashicorp/aws")
+	n.notify(context.Background(), config, notification)
+	if got := len(recorder.received()); got != 3 {
+		t.Fatalf("repeat after resolving sent %d requests in total, want 3", got)
+	}
+}
+
+func TestNotificationKey(t *testing.T) {
+	instance := func(version string, arch string) ProviderSpecificInstance {
+		return ProviderSpecificInstance{Provider: testProvider(), Version: version, OS: "linux", Arch: arch}
+	}
+	failure := func(failures ...InstanceFailure) Notification {
+		return newSyncFailureNotification("registry.terraform.io/hashicorp/aws", &InstanceFailuresError{Provider: "registry.terraform.io/hashicorp/aws", Failures: failures})
+	}
+
+	tests := []struct {
+		name string
+		a    Notification
+		b    Notification
+		same bool
+	}{
+		{
+			"same instances with different errors",
+			failure(
+				InstanceFailure{Instance: instance("1.0.0", "amd64"), Err: errors.New("connection reset by 10.0.0.1:443")},
+				InstanceFailure{Instance: instance("1.0.0", "arm64"), Err: errors.New("HTTP 503, request id abc")},
+			),
+			failure(
+				InstanceFailure{Instance: instance("1.0.0", "arm64"), Err: errors.New("HTTP 503, request id def")},
+				InstanceFailure{Instance: instance("1.0.0", "amd64"), Err: errors.New("connection reset by 10.0.0.2:443")},
+			),
+			true,
+		},
+		{
+			"different instances",
+			failure(InstanceFailure{Instance: instance("1.0.0", "amd64"), Err: errors.New("checksum mismatch")}),
+			failure(InstanceFailure{Instance: instance("1.0.1", "amd64"), Err: errors.New("checksum mismatch")}),
+			false,
+		},
+		{
+			"different events",
+			Notification{Event: notifySyncFailure, Provider: "registry.terraform.io/hashicorp/aws"},
+			Notification{Event: notifyIntegrity, Provider: "registry.terraform.io/hashicorp/aws"},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := tt.a.key() == tt.b.key(); same != tt.same {
+				t.Errorf("keys equal = %v, want %v", same, tt.same)
+			}
+		})
+	}
+}
+
+func TestNotifierEventFilter(t *testing.T) {
+	failures := newWebhookRecorder(t)
+	everything := newWebhookRecorder(t)
+	config := notificationsConfig{Webhooks: []webhookConfig{
+		{URL: failures.server.URL, Events: []string{notifySyncFailure}},
+		{URL: everything.server.URL},
+	}}
+	n := newNotifier()
+
+	notification, ok := newVersionsNotification("registry.terraform.io/hashicorp/aws", nil, []ProviderSpecificInstanceBinary{
+		{ProviderSpecificInstance: ProviderSpecificInstance{Version: "5.0.0", OS: "linux", Arch: "amd64"}},
+	})
+	if !ok {
+		t.Fatal("expected a new versions notification")
+	}
+	n.notify(context.Background(), config, notification)
+
+	if got := len(failures.received()); got != 0 {
+		t.Errorf("sync_failure webhook got %d requests, want 0", got)
+	}
+	if got := len(everything.received()); got != 1 {
+		t.Errorf("unfiltered webhook got %d requests, want 1", got)
+	}
+}
+
+func TestNewVersionsNotification(t *testing.T) {
+	psib := func(version, os, arch string) ProviderSpecificInstanceBinary {
+		return ProviderSpecificInstanceBinary{ProviderSpecificInstance: ProviderSpecificInstance{Version: version, OS: os, Arch: arch}}
+	}
+	previous := []ProviderSpecificInstanceBinary{psib("5.0.0", "linux", "amd64")}
+
+	tests := []struct {
+		name      string
+		current   []ProviderSpecificInstanceBinary
+		wantOK    bool
+		wantItems []NotificationItem
+	}{
+		{
+			name:    "nothing new",
+			current: []ProviderSpecificInstanceBinary{psib("5.0.0", "linux", "amd64")},
+			wantOK:  false,
+		},
+		{
+			name:    "re-downloaded platform of a known version is not new",
+			current: []ProviderSpecificInstanceBinary{psib("5.0.0", "linux", "amd64"), psib("5.0.0", "darwin", "arm64")},
+			wantOK:  false,
+		},
+		{
+			name: "new version with its platforms",
+			current: []ProviderSpecificInstanceBinary{
+				psib("5.0.0", "linux", "amd64"),
+				psib("5.1.0", "linux", "amd64"),
+				psib("5.1.0", "darwin", "arm64"),
+			},
+			wantOK:    true,
+			wantItems: []NotificationItem{{Version: "5.1.0", Platform: "darwin_arm64, linux_amd64"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := newVersionsNotification("registry.terraform.io/hashicorp/aws", previous, tt.current)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if len(got.Items) != len(tt.wantItems) {
+				t.Fatalf("items = %+v, want %+v", got.Items, tt.wantItems)
+			}
+			for i := range got.Items {
+				if got.Items[i] != tt.wantItems[i] {
+					t.Errorf("item %d = %+v, want %+v", i, got.Items[i], tt.wantItems[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateNotificationsConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  notificationsConfig
+		wantErr bool
+	}{
+		{"empty", notificationsConfig{}, false},
+		{"valid", notificationsConfig{Webhooks: []webhookConfig{{URL: "https://example.com", Format: "slack", Events: []string{notifyIntegrity}}}}, false},
+		{"missing url", notificationsConfig{Webhooks: []webhookConfig{{}}}, true},
+		{"unknown format", notificationsConfig{Webhooks: []webhookConfig{{URL: "https://example.com", Format: "teams"}}}, true},
+		{"unknown event", notificationsConfig{Webhooks: []webhookConfig{{URL: "https://example.com", Events: []string{"everything"}}}}, true},
+		{"negative repeat interval", notificationsConfig{RepeatInterval: -time.Minute}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateNotificationsConfig(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateNotificationsConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
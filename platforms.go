@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// matches any OS or arch in os_archs
+const platformWildcard = "*"
+
+// os_archs entries can be written as {os: linux, arch: amd64} or as a string: "linux_amd64", "linux_*", "*" or
+// "all" for every platform, or the name of an entry in platform_sets. Set names are kept in OS with an empty Arch
+// until LoadConfig expands them.
+func (pp *HCTFProviderPlatform) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.MappingNode {
+		// Node.Decode does not know about the decoder's KnownFields, so unknown keys are caught here
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			key := value.Content[i]
+			if key.Value != "os" && key.Value != "arch" {
+				return &yaml.TypeError{Errors: []string{fmt.Sprintf("line %d: field %s not found", key.Line, key.Value)}}
+			}
+		}
+	}
+	if value.Kind != yaml.ScalarNode {
+		type plain HCTFProviderPlatform
+		return value.Decode((*plain)(pp))
+	}
+
+	switch value.Value {
+	case platformWildcard, "all":
+		*pp = HCTFProviderPlatform{OS: platformWildcard, Arch: platformWildcard}
+		return nil
+	}
+	osName, arch, found := strings.Cut(value.Value, "_")
+	if !found {
+		*pp = HCTFProviderPlatform{OS: value.Value}
+		return nil
+	}
+	if osName == "" || arch == "" {
+		return &yaml.TypeError{Errors: []string{fmt.Sprintf("line %d: %q is not a platform, expected OS_ARCH", value.Line, value.Value)}}
+	}
+	*pp = HCTFProviderPlatform{OS: osName, Arch: arch}
+	return nil
+}
+
+// the operating systems and architectures that Terraform providers are built for, to catch typos in os_archs
+var (
+	knownPlatformOSes   = []string{"darwin", "freebsd", "linux", "netbsd", "openbsd", "solaris", "windows"}
+	knownPlatformArches = []string{"386", "amd64", "arm", "arm64", "ppc64le", "riscv64", "s390x"}
+)
+
+// checks that a platform, after platform sets were expanded, names a known OS and arch or a wildcard
+func validatePlatform(platform HCTFProviderPlatform, where string) error {
+	if platform.Arch == "" {
+		// a set reference that could not be expanded, which was reported already
+		return nil
+	}
+	if platform.OS != platformWildcard && !StringInSlice(platform.OS, knownPlatformOSes) {
+		return fmt.Errorf("%s: unknown OS %q in %s, expected one of %s or *", where, platform.OS, platform, strings.Join(knownPlatformOSes, ", "))
+	}
+	if platform.Arch != platformWildcard && !StringInSlice(platform.Arch, knownPlatformArches) {
+		return fmt.Errorf("%s: unknown arch %q in %s, expected one of %s or *", where, platform.Arch, platform, strings.Join(knownPlatformArches, ", "))
+	}
+	return nil
+}
+
+// whether an upstream platform is one that this requested platform asks for
+func (pp HCTFProviderPlatform) matches(upstream HCTFProviderPlatform) bool {
+	return (pp.OS == platformWildcard || pp.OS == upstream.OS) && (pp.Arch == platformWildcard || pp.Arch == upstream.Arch)
+}
+
+// replaces references to platform sets in os_archs with the platforms in the set
+func expandPlatformSets(platforms []HCTFProviderPlatform, sets map[string][]HCTFProviderPlatform) ([]HCTFProviderPlatform, error) {
+	var expanded []HCTFProviderPlatform
+	for _, platform := range platforms {
+		if platform.Arch != "" {
+			expanded = append(expanded, platform)
+			continue
+		}
+		set, ok := sets[platform.OS]
+		if !ok {
+			return nil, fmt.Errorf("os_archs entry %q is neither OS_ARCH nor the name of a platform set", platform.OS)
+		}
+		for _, member := range set {
+			if member.Arch == "" {
+				return nil, fmt.Errorf("platform set %s refers to %q, platform sets cannot refer to other sets", platform.OS, member.OS)
+			}
+		}
+		expanded = append(expanded, set...)
+	}
+	return expanded, nil
+}
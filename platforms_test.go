@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestHCTFProviderPlatformUnmarshalYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    []HCTFProviderPlatform
+		wantErr bool
+	}{
+		{"mapping", "[{os: linux, arch: amd64}]", []HCTFProviderPlatform{{OS: "linux", Arch: "amd64"}}, false},
+		{"mapping with wildcard", `[{os: linux, arch: "*"}]`, []HCTFProviderPlatform{{OS: "linux", Arch: "*"}}, false},
+		{"string", "[darwin_arm64]", []HCTFProviderPlatform{{OS: "darwin", Arch: "arm64"}}, false},
+		{"string with wildcard", `["linux_*"]`, []HCTFProviderPlatform{{OS: "linux", Arch: "*"}}, false},
+		{"everything", `["*", all]`, []HCTFProviderPlatform{{OS: "*", Arch: "*"}, {OS: "*", Arch: "*"}}, false},
+		{"set name", "[workstations]", []HCTFProviderPlatform{{OS: "workstations"}}, false},
+		{"missing arch", "[linux_]", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []HCTFProviderPlatform
+			err := yaml.Unmarshal([]byte(tt.yaml), &got)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHCTFProviderPlatformMatches(t *testing.T) {
+	upstream := HCTFProviderPlatform{OS: "linux", Arch: "arm64"}
+	tests := []struct {
+		requested HCTFProviderPlatform
+		want      bool
+	}{
+		{HCTFProviderPlatform{OS: "linux", Arch: "arm64"}, true},
+		{HCTFProviderPlatform{OS: "linux", Arch: "amd64"}, false},
+		{HCTFProviderPlatform{OS: "linux", Arch: "*"}, true},
+		{HCTFProviderPlatform{OS: "*", Arch: "arm64"}, true},
+		{HCTFProviderPlatform{OS: "darwin", Arch: "*"}, false},
+		{HCTFProviderPlatform{OS: "*", Arch: "*"}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.requested.matches(upstream); got != tt.want {
+			t.Errorf("%s matches %s = %t, want %t", tt.requested, upstream, got, tt.want)
+		}
+	}
+}
+
+func TestExpandPlatformSets(t *testing.T) {
+	sets := map[string][]HCTFProviderPlatform{
+		"workstations": {{OS: "darwin", Arch: "arm64"}, {OS: "windows", Arch: "amd64"}},
+		"nested":       {{OS: "workstations"}},
+	}
+
+	got, err := expandPlatformSets([]HCTFProviderPlatform{{OS: "linux", Arch: "*"}, {OS: "workstations"}}, sets)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []HCTFProviderPlatform{{OS: "linux", Arch: "*"}, {OS: "darwin", Arch: "arm64"}, {OS: "windows", Arch: "amd64"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	_, err = expandPlatformSets([]HCTFProviderPlatform{{OS: "servers"}}, sets)
+	if err == nil {
+		t.Error("expected error for an unknown set")
+	}
+	_, err = expandPlatformSets([]HCTFProviderPlatform{{OS: "nested"}}, sets)
+	if err == nil {
+		t.Error("expected error for a set that refers to another set")
+	}
+}
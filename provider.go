@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"time"
 
 	semver "github.com/blang/semver/v4"
 )
@@ -19,6 +22,17 @@ func (p Provider) String() string {
 	return p.GetDownloadBase()
 }
 
+// checks that each part of the address can be used as a single path element, since storage paths are built from
+// them; needed for addresses that come from archives or flags rather than from a registry
+func (p Provider) validateAddress() error {
+	for _, part := range []string{p.Hostname, p.Owner, p.Name} {
+		if part == "" || part == "." || part == ".." || strings.ContainsAny(part, `/\`) {
+			return fmt.Errorf("invalid provider address %q/%q/%q", p.Hostname, p.Owner, p.Name)
+		}
+	}
+	return nil
+}
+
 func (pi ProviderSpecificInstance) String() string {
 	return fmt.Sprintf("%s/%s/%s %s %s_%s", pi.Hostname, pi.Owner, pi.Name, pi.Version, pi.OS, pi.Arch)
 }
@@ -27,9 +41,47 @@ func (pi ProviderSpecificInstance) GetDownloadedFileName() string {
 	return fmt.Sprintf("terraform-provider-%s_%s_%s_%s.zip", pi.Name, pi.Version, pi.OS, pi.Arch)
 }
 
+// the inverse of GetDownloadedFileName, used for files that were not downloaded by tfspiegel itself
+func (p Provider) ParseDownloadedFileName(filename string) (ProviderSpecificInstance, error) {
+	var pi ProviderSpecificInstance
+
+	trimmed, found := strings.CutPrefix(filename, "terraform-provider-")
+	if !found {
+		return pi, fmt.Errorf("%s does not start with terraform-provider-", filename)
+	}
+	trimmed, found = strings.CutSuffix(trimmed, ".zip")
+	if !found {
+		return pi, fmt.Errorf("%s is not a zip file", filename)
+	}
+	parts := strings.Split(trimmed, "_")
+	if len(parts) != 4 {
+		return pi, fmt.Errorf("%s is not of the form terraform-provider-NAME_VERSION_OS_ARCH.zip", filename)
+	}
+	if parts[0] != p.Name {
+		return pi, fmt.Errorf("%s does not belong to provider %s", filename, p)
+	}
+	_, err := semver.Parse(parts[1])
+	if err != nil {
+		return pi, fmt.Errorf("%s has an invalid version: %w", filename, err)
+	}
+
+	pi = ProviderSpecificInstance{
+		Provider: p,
+		Version:  parts[1],
+		OS:       parts[2],
+		Arch:     parts[3],
+	}
+	return pi, nil
+}
+
 func NewProviderFromConfigProvider(providerURL string) (Provider, error) {
+	return newProviderWithDefaultHostname(providerURL, defaultProviderHostname)
+}
+
+// like NewProviderFromConfigProvider, for references without a hostname that should resolve to another registry
+func newProviderWithDefaultHostname(providerURL string, hostname string) (Provider, error) {
 	provider := Provider{
-		Hostname: defaultProviderHostname,
+		Hostname: hostname,
 		Owner:    defaultProviderOwner,
 	}
 
@@ -52,27 +104,20 @@ func NewProviderFromConfigProvider(providerURL string) (Provider, error) {
 }
 
 // Fetches the JSON file from the registry for a given provider that lists the available versions and platforms.
-func (p Provider) GetProviderMetadataFromRegistry() (RemoteProviderMetadata, error) {
+// The token is sent to the registry if it is not empty.
+func (p Provider) GetProviderMetadataFromRegistry(ctx context.Context, token string) (RemoteProviderMetadata, error) {
 	remoteProviderMetadata := RemoteProviderMetadata{
 		Provider: p,
 	}
 
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://%s/v1/providers/%s/%s/versions", p.Hostname, p.Owner, p.Name), nil)
-	if err != nil {
-		return remoteProviderMetadata, fmt.Errorf("error creating HTTP request for provider metadata: %w", err)
-	}
-	resp, err := httpClient.Do(req)
+	// the list changes whenever a version is published, so it is always revalidated
+	versionsURL := fmt.Sprintf("%s%s/%s/versions", providersAPIBase(ctx, p.Hostname, token), p.Owner, p.Name)
+	responseJson, status, err := registryResponses.get(ctx, versionsURL, token, 0)
 	if err != nil {
 		return remoteProviderMetadata, fmt.Errorf("error fetching provider metadata from registry: %w", err)
 	}
-	defer func() { _ = resp.Body.Close() }()
-	if resp.StatusCode >= 400 {
-		return remoteProviderMetadata, fmt.Errorf("HTTP %d fetching provider metadata for %s", resp.StatusCode, p)
-	}
-
-	responseJson, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return remoteProviderMetadata, fmt.Errorf("error reading provider metadata response body: %w", err)
+	if status != http.StatusOK {
+		return remoteProviderMetadata, fmt.Errorf("HTTP %d fetching provider metadata for %s", status, p)
 	}
 	err = json.Unmarshal(responseJson, &remoteProviderMetadata)
 	if err != nil {
@@ -92,6 +137,7 @@ func (p Provider) FilterToWantedPVIs(providerMetadata RemoteProviderMetadata, pr
 	if err != nil {
 		return filteredProviders, err
 	}
+	exactVersions := exactVersionsInRange(providerConfig.VersionRange)
 
 	var versionsToSkip []semver.Version
 
@@ -104,6 +150,7 @@ func (p Provider) FilterToWantedPVIs(providerMetadata RemoteProviderMetadata, pr
 		versionsToSkip = append(versionsToSkip, parsed)
 	}
 
+	var candidates []candidateVersion
 	for _, upstreamProvider := range providerMetadata.Versions {
 		upstreamVersion, err := semver.Parse(upstreamProvider.Version)
 		if err != nil {
@@ -113,22 +160,41 @@ func (p Provider) FilterToWantedPVIs(providerMetadata RemoteProviderMetadata, pr
 		if !parsedRange(upstreamVersion) {
 			continue
 		}
+		if !prereleaseWanted(upstreamVersion, providerConfig.IncludePrereleases, exactVersions) {
+			continue
+		}
 
 		skipThisVersion := false
 		for _, versionToSkip := range versionsToSkip {
 			if upstreamVersion.Equals(versionToSkip) {
 				skipThisVersion = true
+				break
 			}
-			break
 		}
 		if skipThisVersion {
 			continue
 		}
+		candidates = append(candidates, candidateVersion{version: upstreamVersion, publishedAt: upstreamProvider.PublishedAt})
+	}
+	keptVersions := providerConfig.Keep.selectVersions(candidates, time.Now())
+
+	for _, upstreamProvider := range providerMetadata.Versions {
+		upstreamVersion, err := semver.Parse(upstreamProvider.Version)
+		if err != nil || !keptVersions[upstreamVersion.String()] {
+			continue
+		}
 
+		// a platform can be asked for more than once through wildcards and platform sets
+		added := make(map[HCTFProviderPlatform]bool)
 		for _, requestedOSArch := range osArchs {
 			foundOSArch := false
 			for _, upstreamOSArch := range upstreamProvider.Platforms {
-				if upstreamOSArch.Arch == requestedOSArch.Arch && upstreamOSArch.OS == requestedOSArch.OS {
+				if requestedOSArch.matches(upstreamOSArch) {
+					foundOSArch = true
+					if added[upstreamOSArch] {
+						continue
+					}
+					added[upstreamOSArch] = true
 					providerInstance := ProviderSpecificInstance{
 						Provider: p,
 						Version:  upstreamVersion.String(),
@@ -136,7 +202,6 @@ func (p Provider) FilterToWantedPVIs(providerMetadata RemoteProviderMetadata, pr
 						Arch:     upstreamOSArch.Arch,
 					}
 					filteredProviders = append(filteredProviders, providerInstance)
-					foundOSArch = true
 				}
 			}
 			if !foundOSArch {
@@ -147,3 +212,88 @@ func (p Provider) FilterToWantedPVIs(providerMetadata RemoteProviderMetadata, pr
 
 	return filteredProviders, nil
 }
+
+// like Terraform, a pre-release is only wanted if the range names it exactly, unless include_prereleases is set
+func prereleaseWanted(version semver.Version, includePrereleases bool, exactVersions []semver.Version) bool {
+	if len(version.Pre) == 0 || includePrereleases {
+		return true
+	}
+	for _, exact := range exactVersions {
+		if version.Equals(exact) {
+			return true
+		}
+	}
+	return false
+}
+
+// the versions that a range names exactly, as "1.2.3", "=1.2.3" or "==1.2.3"
+func exactVersionsInRange(versionRange string) []semver.Version {
+	var exact []semver.Version
+	terms := strings.FieldsFunc(versionRange, func(r rune) bool { return r == ' ' || r == '|' })
+	for i := 0; i < len(terms); i++ {
+		term := terms[i]
+		// blang/semver allows a space between the operator and the version
+		if strings.Trim(term, "<>=!") == "" && i+1 < len(terms) {
+			i++
+			term += terms[i]
+		}
+		trimmed := strings.TrimLeft(term, "=")
+		if strings.HasPrefix(term, "!") || strings.ContainsAny(trimmed, "<>!") {
+			continue
+		}
+		version, err := semver.Parse(trimmed)
+		if err == nil {
+			exact = append(exact, version)
+		}
+	}
+	return exact
+}
+
+// the versions listed upstream that are not semantic versions, which are never mirrored
+func unparseableVersions(providerMetadata RemoteProviderMetadata) []string {
+	unparseable := []string{}
+	for _, version := range providerMetadata.Versions {
+		if _, err := semver.Parse(version.Version); err != nil {
+			unparseable = append(unparseable, version.Version)
+		}
+	}
+	return unparseable
+}
+
+// returns the platforms configured for a provider, or the current platform if none were set
+func wantedOSArchs(configProvider ProviderMirrorConfiguration, provider Provider) []HCTFProviderPlatform {
+	if len(configProvider.OSArchs) > 0 {
+		return configProvider.OSArchs
+	}
+	sugar.Warnf("provider %s does not have OS/archs set, using current platform (%s/%s) as defaults; set os_archs under defaults, or strict to make this an error", provider, runtime.GOOS, runtime.GOARCH)
+	return []HCTFProviderPlatform{{runtime.GOOS, runtime.GOARCH}}
+}
+
+// Builds registry-style metadata out of an existing catalog, so that the same filtering that decides what to
+// download can be used to decide what is already mirrored but no longer wanted.
+func RemoteProviderMetadataFromCatalog(p Provider, catalog []ProviderSpecificInstanceBinary) RemoteProviderMetadata {
+	platformsByVersion := make(map[string][]HCTFProviderPlatform)
+	publishedAtByVersion := make(map[string]time.Time)
+	for _, psib := range catalog {
+		platformsByVersion[psib.Version] = append(platformsByVersion[psib.Version], HCTFProviderPlatform{OS: psib.OS, Arch: psib.Arch})
+		if !psib.PublishedAt.IsZero() {
+			publishedAtByVersion[psib.Version] = psib.PublishedAt
+		}
+	}
+
+	metadata := RemoteProviderMetadata{
+		Provider: p,
+	}
+	for version, platforms := range platformsByVersion {
+		metadata.Versions = append(metadata.Versions, HCTFProviderVersion{
+			Version:     version,
+			Platforms:   platforms,
+			PublishedAt: publishedAtByVersion[version],
+		})
+	}
+	sort.Slice(metadata.Versions, func(i, j int) bool {
+		return metadata.Versions[i].Version < metadata.Versions[j].Version
+	})
+
+	return metadata
+}
@@ -159,7 +159,7 @@ func TestGetProviderMetadataFromRegistry(t *testing.T) {
 			serverHost := server.URL[len("https://"):]
 
 			p := Provider{Hostname: serverHost, Owner: "hashicorp", Name: "aws"}
-			got, err := p.GetProviderMetadataFromRegistry()
+			got, err := p.GetProviderMetadataFromRegistry(t.Context(), "")
 			if tt.wantErr {
 				if err == nil {
 					t.Fatal("expected error, got nil")
@@ -189,7 +189,7 @@ func TestGetProviderMetadataFromRegistryInvalidJSON(t *testing.T) {
 
 	serverHost := server.URL[len("https://"):]
 	p := Provider{Hostname: serverHost, Owner: "hashicorp", Name: "aws"}
-	_, err := p.GetProviderMetadataFromRegistry()
+	_, err := p.GetProviderMetadataFromRegistry(t.Context(), "")
 	if err == nil {
 		t.Fatal("expected error for invalid JSON, got nil")
 	}
@@ -304,6 +304,34 @@ func TestFilterToWantedPVIs(t *testing.T) {
 			nil,
 			true,
 		},
+		{
+			"wildcards expand against upstream platforms without duplicates",
+			ProviderMirrorConfiguration{
+				Reference:    "merp",
+				VersionRange: ">=5.0.0",
+			},
+			[]HCTFProviderPlatform{{OS: "*", Arch: "*"}, {OS: "linux", Arch: "amd64"}},
+			[]ProviderSpecificInstance{
+				{Provider: p, Version: "5.0.0", OS: "linux", Arch: "amd64"},
+				{Provider: p, Version: "5.0.0", OS: "darwin", Arch: "arm64"},
+				{Provider: p, Version: "5.1.0", OS: "linux", Arch: "amd64"},
+			},
+			false,
+		},
+		{
+			"keep policy applies within the range",
+			ProviderMirrorConfiguration{
+				Reference:    "merp",
+				VersionRange: "<5.1.0",
+				OSArchs:      []HCTFProviderPlatform{{OS: "linux", Arch: "amd64"}},
+				Keep:         versionPolicyConfig{Latest: 1},
+			},
+			[]HCTFProviderPlatform{{OS: "linux", Arch: "amd64"}},
+			[]ProviderSpecificInstance{
+				{Provider: p, Version: "5.0.0", OS: "linux", Arch: "amd64"},
+			},
+			false,
+		},
 		{
 			"skip a particular version",
 			ProviderMirrorConfiguration{
@@ -319,6 +347,21 @@ func TestFilterToWantedPVIs(t *testing.T) {
 			},
 			false,
 		},
+		{
+			// each version must stay skipped whatever the entries after the one it matches say
+			"skip several versions",
+			ProviderMirrorConfiguration{
+				Reference:    "merp",
+				VersionRange: ">=4.0.0",
+				OSArchs:      []HCTFProviderPlatform{{OS: "linux", Arch: "amd64"}},
+				SkipVersions: []string{"4.0.0", "5.1.0", "6.0.0"},
+			},
+			[]HCTFProviderPlatform{{OS: "linux", Arch: "amd64"}},
+			[]ProviderSpecificInstance{
+				{Provider: p, Version: "5.0.0", OS: "linux", Arch: "amd64"},
+			},
+			false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -342,3 +385,124 @@ func TestFilterToWantedPVIs(t *testing.T) {
 		})
 	}
 }
+
+func TestProviderParseDownloadedFileName(t *testing.T) {
+	p := Provider{Hostname: "registry.terraform.io", Owner: "hashicorp", Name: "aws"}
+
+	tests := []struct {
+		name     string
+		filename string
+		expected ProviderSpecificInstance
+		wantErr  bool
+	}{
+		{
+			"valid file name",
+			"terraform-provider-aws_5.0.0_linux_amd64.zip",
+			ProviderSpecificInstance{Provider: p, Version: "5.0.0", OS: "linux", Arch: "amd64"},
+			false,
+		},
+		{
+			"pre-release version",
+			"terraform-provider-aws_5.0.0-beta1_darwin_arm64.zip",
+			ProviderSpecificInstance{Provider: p, Version: "5.0.0-beta1", OS: "darwin", Arch: "arm64"},
+			false,
+		},
+		{"missing prefix", "aws_5.0.0_linux_amd64.zip", ProviderSpecificInstance{}, true},
+		{"not a zip", "terraform-provider-aws_5.0.0_linux_amd64.tar.gz", ProviderSpecificInstance{}, true},
+		{"wrong provider", "terraform-provider-google_5.0.0_linux_amd64.zip", ProviderSpecificInstance{}, true},
+		{"missing arch", "terraform-provider-aws_5.0.0_linux.zip", ProviderSpecificInstance{}, true},
+		{"invalid version", "terraform-provider-aws_five_linux_amd64.zip", ProviderSpecificInstance{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.ParseDownloadedFileName(tt.filename)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("got %+v, want %+v", got, tt.expected)
+			}
+			if got.GetDownloadedFileName() != tt.filename {
+				t.Errorf("round trip gave %q, want %q", got.GetDownloadedFileName(), tt.filename)
+			}
+		})
+	}
+}
+
+func TestRemoteProviderMetadataFromCatalog(t *testing.T) {
+	p := Provider{Hostname: "registry.terraform.io", Owner: "hashicorp", Name: "aws"}
+	catalog := []ProviderSpecificInstanceBinary{
+		{ProviderSpecificInstance: ProviderSpecificInstance{Provider: p, Version: "5.1.0", OS: "linux", Arch: "amd64"}},
+		{ProviderSpecificInstance: ProviderSpecificInstance{Provider: p, Version: "5.0.0", OS: "linux", Arch: "amd64"}},
+		{ProviderSpecificInstance: ProviderSpecificInstance{Provider: p, Version: "5.0.0", OS: "darwin", Arch: "arm64"}},
+	}
+
+	got := RemoteProviderMetadataFromCatalog(p, catalog)
+	if got.Provider != p {
+		t.Errorf("provider = %+v, want %+v", got.Provider, p)
+	}
+	if len(got.Versions) != 2 {
+		t.Fatalf("expected 2 versions, got %d", len(got.Versions))
+	}
+	if got.Versions[0].Version != "5.0.0" || len(got.Versions[0].Platforms) != 2 {
+		t.Errorf("unexpected first version %+v", got.Versions[0])
+	}
+	if got.Versions[1].Version != "5.1.0" || len(got.Versions[1].Platforms) != 1 {
+		t.Errorf("unexpected second version %+v", got.Versions[1])
+	}
+}
+
+func TestFilterToWantedPVIsPrereleases(t *testing.T) {
+	p := Provider{Hostname: "registry.terraform.io", Owner: "hashicorp", Name: "aws"}
+	platforms := []HCTFProviderPlatform{{OS: "linux", Arch: "amd64"}}
+	metadata := RemoteProviderMetadata{
+		Provider: p,
+		Versions: []HCTFProviderVersion{
+			{Version: "5.0.0", Platforms: platforms},
+			{Version: "5.1.0-beta1", Platforms: platforms},
+			{Version: "5.1.0", Platforms: platforms},
+			{Version: "latest", Platforms: platforms},
+		},
+	}
+
+	tests := []struct {
+		name               string
+		versionRange       string
+		includePrereleases bool
+		want               []string
+	}{
+		{"pre-releases are left out of open ranges", ">=5.0.0", false, []string{"5.0.0", "5.1.0"}},
+		{"pre-releases named exactly are mirrored", "5.1.0-beta1", false, []string{"5.1.0-beta1"}},
+		{"exact with operator and space", ">=5.0.0 <5.1.0 || = 5.1.0-beta1", false, []string{"5.0.0", "5.1.0-beta1"}},
+		{"include_prereleases mirrors pre-releases in range", ">=5.0.0", true, []string{"5.0.0", "5.1.0-beta1", "5.1.0"}},
+		{"include_prereleases still honours the range", ">=5.0.0 <5.1.0-beta1", true, []string{"5.0.0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pmc := ProviderMirrorConfiguration{Reference: "aws", VersionRange: tt.versionRange, IncludePrereleases: tt.includePrereleases}
+			got, err := p.FilterToWantedPVIs(metadata, pmc, platforms)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var versions []string
+			for _, pi := range got {
+				versions = append(versions, pi.Version)
+			}
+			if !reflect.DeepEqual(versions, tt.want) {
+				t.Errorf("got %v, want %v", versions, tt.want)
+			}
+		})
+	}
+
+	if got := unparseableVersions(metadata); !reflect.DeepEqual(got, []string{"latest"}) {
+		t.Errorf("unparseable versions = %v, want [latest]", got)
+	}
+}
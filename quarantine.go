@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// a version that is wanted but held back because it was released or first seen less than min_age ago
+type PendingVersion struct {
+	Version   string    `json:"version"`
+	FirstSeen time.Time `json:"first_seen"`
+	ReadyAt   time.Time `json:"ready_at"`
+}
+
+// records when the clock started for wanted versions: the release date where the source gives one, otherwise
+// now for versions that have no time yet. Versions that are already in the catalog are counted from when they
+// were first mirrored, so that turning on min_age does not hold back what is already in the mirror. A release
+// date earlier than the recorded time replaces it, which fixes up versions that a fresh mirror stamped with the
+// time of its first sync. Without a release date, versions that are upstream the first time a provider is looked
+// at count as old enough, since there is no telling how long they have been out and a fresh mirror of an
+// upstream mirror would otherwise hold back every version. Returns whether anything changed.
+func recordFirstSeen(firstSeen map[string]time.Time, wanted []ProviderSpecificInstance, catalog []ProviderSpecificInstanceBinary, released map[string]time.Time, now time.Time) bool {
+	firstObservation := len(firstSeen) == 0
+	mirroredAt := make(map[string]time.Time)
+	for _, psib := range catalog {
+		earliest, ok := mirroredAt[psib.Version]
+		if !psib.MirroredAt.IsZero() && (!ok || psib.MirroredAt.Before(earliest)) {
+			mirroredAt[psib.Version] = psib.MirroredAt
+		} else if !ok {
+			mirroredAt[psib.Version] = time.Time{}
+		}
+	}
+
+	changed := false
+	for _, pi := range wanted {
+		seen, recorded := firstSeen[pi.Version]
+		if !recorded {
+			var inCatalog bool
+			seen, inCatalog = mirroredAt[pi.Version]
+			switch {
+			case inCatalog && seen.IsZero():
+				// mirrored before timestamps were recorded, so old enough by any measure
+				seen = time.Unix(0, 0).UTC()
+			case !inCatalog && firstObservation && released[pi.Version].IsZero():
+				seen = time.Unix(0, 0).UTC()
+			case !inCatalog:
+				seen = now
+			}
+		}
+		if releasedAt, ok := released[pi.Version]; ok && releasedAt.Before(seen) {
+			seen = releasedAt
+		}
+		if !recorded || !seen.Equal(firstSeen[pi.Version]) {
+			firstSeen[pi.Version] = seen
+			changed = true
+		}
+	}
+	return changed
+}
+
+// fetches the release dates of the versions in toDownload that could still be held back, from sources that
+// know them. Versions whose date cannot be fetched are left out and fall back to when they were first seen.
+func releaseDates(ctx context.Context, source ProviderSource, provider Provider, toDownload []ProviderSpecificInstance, firstSeen map[string]time.Time, minAge time.Duration, now time.Time) (map[string]time.Time, error) {
+	dated, ok := source.(publishedDateSource)
+	if !ok {
+		return nil, nil
+	}
+	released := make(map[string]time.Time)
+	for _, pi := range toDownload {
+		if _, fetched := released[pi.Version]; fetched {
+			continue
+		}
+		if seen, ok := firstSeen[pi.Version]; ok && !now.Before(seen.Add(minAge)) {
+			continue
+		}
+		publishedAt, err := dated.getPublishedDate(ctx, provider, pi.Version)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			sugar.Debugf("error fetching release date of %s %s, counting from when it was first seen: %v", provider, pi.Version, err)
+			continue
+		}
+		released[pi.Version] = publishedAt
+	}
+	return released, nil
+}
+
+// splits the wanted instances into those whose version is at least minAge old and the versions that are not
+func holdBackYoungVersions(wanted []ProviderSpecificInstance, firstSeen map[string]time.Time, minAge time.Duration, now time.Time) ([]ProviderSpecificInstance, []PendingVersion) {
+	if minAge <= 0 {
+		return wanted, nil
+	}
+
+	var ready []ProviderSpecificInstance
+	pending := make(map[string]PendingVersion)
+	for _, pi := range wanted {
+		seen, ok := firstSeen[pi.Version]
+		if !ok {
+			seen = now
+		}
+		readyAt := seen.Add(minAge)
+		if now.Before(readyAt) {
+			pending[pi.Version] = PendingVersion{Version: pi.Version, FirstSeen: seen, ReadyAt: readyAt}
+			continue
+		}
+		ready = append(ready, pi)
+	}
+
+	var pendingVersions []PendingVersion
+	for _, version := range pending {
+		pendingVersions = append(pendingVersions, version)
+	}
+	sort.Slice(pendingVersions, func(i, j int) bool {
+		return pendingVersions[i].Version < pendingVersions[j].Version
+	})
+	return ready, pendingVersions
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecordFirstSeen(t *testing.T) {
+	p := testProvider()
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	mirrored := now.AddDate(0, -1, 0)
+	pi := func(version string) ProviderSpecificInstance {
+		return ProviderSpecificInstance{Provider: p, Version: version, OS: "linux", Arch: "amd64"}
+	}
+	catalog := []ProviderSpecificInstanceBinary{
+		{ProviderSpecificInstance: pi("4.0.0")},
+		{ProviderSpecificInstance: pi("5.0.0"), MirroredAt: mirrored},
+	}
+	known := now.AddDate(0, 0, -3)
+	firstSeen := map[string]time.Time{"5.1.0": known}
+
+	changed := recordFirstSeen(firstSeen, []ProviderSpecificInstance{pi("4.0.0"), pi("5.0.0"), pi("5.1.0"), pi("5.2.0")}, catalog, nil, now)
+	if !changed {
+		t.Error("expected new versions to be recorded")
+	}
+	want := map[string]time.Time{
+		"4.0.0": time.Unix(0, 0).UTC(),
+		"5.0.0": mirrored,
+		"5.1.0": known,
+		"5.2.0": now,
+	}
+	if !reflect.DeepEqual(firstSeen, want) {
+		t.Errorf("got %v, want %v", firstSeen, want)
+	}
+
+	if recordFirstSeen(firstSeen, []ProviderSpecificInstance{pi("5.2.0")}, catalog, nil, now.Add(time.Hour)) {
+		t.Error("expected nothing to change for versions already seen")
+	}
+	if !firstSeen["5.2.0"].Equal(now) {
+		t.Errorf("first seen time of 5.2.0 was moved to %s", firstSeen["5.2.0"])
+	}
+
+	// a release date that turns up later moves the clock back, but never forward
+	releasedAt := now.AddDate(0, 0, -10)
+	released := map[string]time.Time{"5.2.0": releasedAt, "5.1.0": now}
+	if !recordFirstSeen(firstSeen, []ProviderSpecificInstance{pi("5.1.0"), pi("5.2.0")}, catalog, released, now) {
+		t.Error("expected the release date to be recorded")
+	}
+	if !firstSeen["5.2.0"].Equal(releasedAt) || !firstSeen["5.1.0"].Equal(known) {
+		t.Errorf("got %v", firstSeen)
+	}
+}
+
+func TestHoldBackYoungVersions(t *testing.T) {
+	p := testProvider()
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	wanted := []ProviderSpecificInstance{
+		{Provider: p, Version: "5.0.0", OS: "linux", Arch: "amd64"},
+		{Provider: p, Version: "5.1.0", OS: "linux", Arch: "amd64"},
+		{Provider: p, Version: "5.1.0", OS: "darwin", Arch: "arm64"},
+	}
+	firstSeen := map[string]time.Time{
+		"5.0.0": now.AddDate(0, 0, -10),
+		"5.1.0": now.AddDate(0, 0, -2),
+	}
+
+	tests := []struct {
+		name        string
+		minAge      time.Duration
+		wantReady   []ProviderSpecificInstance
+		wantPending []PendingVersion
+	}{
+		{"no min age", 0, wanted, nil},
+		{"young version held back", 7 * 24 * time.Hour, wanted[:1], []PendingVersion{
+			{Version: "5.1.0", FirstSeen: firstSeen["5.1.0"], ReadyAt: firstSeen["5.1.0"].Add(7 * 24 * time.Hour)},
+		}},
+		{"old enough", 48 * time.Hour, wanted, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ready, pending := holdBackYoungVersions(wanted, firstSeen, tt.minAge, now)
+			if !reflect.DeepEqual(ready, tt.wantReady) {
+				t.Errorf("ready = %+v, want %+v", ready, tt.wantReady)
+			}
+			if !reflect.DeepEqual(pending, tt.wantPending) {
+				t.Errorf("pending = %+v, want %+v", pending, tt.wantPending)
+			}
+		})
+	}
+}
+
+func TestHoldBackPendingVersionsFreshMirror(t *testing.T) {
+	now := time.Now().UTC()
+	released := map[string]time.Time{
+		"5.0.0": now.AddDate(0, 0, -30),
+		"5.1.0": now.AddDate(0, 0, -2),
+	}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version := path.Base(r.URL.Path)
+		publishedAt, ok := released[version]
+		if !ok {
+			w.WriteHeader(404)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"version": %q, "published_at": %q}`, version, publishedAt.Format(time.RFC3339))
+	}))
+	defer server.Close()
+	oldClient := httpClient
+	httpClient = server.Client()
+	defer func() { httpClient = oldClient }()
+
+	p := Provider{Hostname: server.URL[len("https://"):], Owner: "hashicorp", Name: "aws"}
+	var wanted []ProviderSpecificInstance
+	for _, version := range []string{"5.0.0", "5.1.0", "5.2.0"} {
+		wanted = append(wanted, ProviderSpecificInstance{Provider: p, Version: version, OS: "linux", Arch: "amd64"})
+	}
+	configProvider := ProviderMirrorConfiguration{Reference: "aws", MinAge: 7 * 24 * time.Hour}
+
+	tests := []struct {
+		name        string
+		source      ProviderSource
+		wantReady   []string
+		wantPending []string
+	}{
+		// 5.2.0 has no release date, but was out before the first sync
+		{"registry", registrySource{}, []string{"5.0.0", "5.2.0"}, []string{"5.1.0"}},
+		{"network mirror", newNetworkMirrorSource(&url.URL{Scheme: "https", Host: p.Hostname}, ""), []string{"5.0.0", "5.1.0", "5.2.0"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// nothing in the catalog and no first-seen times, as for a mirror that is synced for the first time
+			var report ProviderReport
+			ready, err := holdBackPendingVersions(t.Context(), mockProviderStorer{}, tt.source, p, configProvider, wanted, wanted, nil, &report)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var readyVersions, pendingVersions []string
+			for _, pi := range ready {
+				readyVersions = append(readyVersions, pi.Version)
+			}
+			for _, pending := range report.Pending {
+				pendingVersions = append(pendingVersions, pending.Version)
+			}
+			if !reflect.DeepEqual(readyVersions, tt.wantReady) {
+				t.Errorf("ready = %v, want %v", readyVersions, tt.wantReady)
+			}
+			if !reflect.DeepEqual(pendingVersions, tt.wantPending) {
+				t.Errorf("pending = %v, want %v", pendingVersions, tt.wantPending)
+			}
+		})
+	}
+}
+
+func TestRecordFirstSeenWithoutReleaseDates(t *testing.T) {
+	p := testProvider()
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	pi := func(version string) ProviderSpecificInstance {
+		return ProviderSpecificInstance{Provider: p, Version: version, OS: "linux", Arch: "amd64"}
+	}
+	minAge := 7 * 24 * time.Hour
+
+	// what is upstream the first time is not held back
+	firstSeen := map[string]time.Time{}
+	recordFirstSeen(firstSeen, []ProviderSpecificInstance{pi("5.0.0"), pi("5.1.0")}, nil, nil, now)
+	ready, pending := holdBackYoungVersions([]ProviderSpecificInstance{pi("5.0.0"), pi("5.1.0")}, firstSeen, minAge, now)
+	if len(ready) != 2 || len(pending) != 0 {
+		t.Errorf("first sync: %d ready and %d pending, want 2 and 0", len(ready), len(pending))
+	}
+
+	// but a version that turns up later is
+	later := now.Add(time.Hour)
+	recordFirstSeen(firstSeen, []ProviderSpecificInstance{pi("5.0.0"), pi("5.1.0"), pi("5.2.0")}, nil, nil, later)
+	ready, pending = holdBackYoungVersions([]ProviderSpecificInstance{pi("5.2.0")}, firstSeen, minAge, later)
+	if len(ready) != 0 || len(pending) != 1 || !pending[0].FirstSeen.Equal(later) {
+		t.Errorf("later sync: ready %v, pending %v, want 5.2.0 pending from %s", ready, pending, later)
+	}
+}
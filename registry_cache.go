@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// a response from a registry or upstream mirror, with what is needed to ask whether it is still current
+type cachedResponse struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+	// how long the response is reused without a request, 0 for responses that are always revalidated
+	TTL  time.Duration `json:"ttl,omitempty"`
+	Body []byte        `json:"body"`
+}
+
+// an entry that can neither be reused nor revalidated any more
+func (e cachedResponse) expired(now time.Time) bool {
+	return e.TTL > 0 && e.ETag == "" && e.LastModified == "" && now.Sub(e.FetchedAt) >= e.TTL
+}
+
+// responses are kept in memory for the life of the process, up to registryCacheMaxEntries of them, and on disk
+// as well if a directory is configured
+type responseCache struct {
+	mu              sync.Mutex
+	entries         map[string]cachedResponse
+	dir             string
+	downloadInfoTTL time.Duration
+}
+
+var registryResponses = &responseCache{
+	entries:         map[string]cachedResponse{},
+	downloadInfoTTL: defaultDownloadInfoTTL,
+}
+
+// applies the registry_cache settings, which can change when the config is reloaded. It runs at the start of
+// every sync, so it also clears out the disk cache.
+func (c *responseCache) configure(config registryCacheConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dir = config.Dir
+	c.downloadInfoTTL = config.DownloadInfoTTL
+	if c.downloadInfoTTL == 0 {
+		c.downloadInfoTTL = defaultDownloadInfoTTL
+	}
+	if c.downloadInfoTTL < 0 {
+		c.downloadInfoTTL = 0
+	}
+	if c.dir != "" {
+		c.evictFromDisk(time.Now())
+	}
+}
+
+// removes the files of entries that have expired and of entries that have not been fetched or revalidated for
+// registryCacheMaxIdle, such as those of providers that are no longer mirrored. Files are rewritten whenever
+// their entry is used, so only files older than the TTL are read to check them.
+func (c *responseCache) evictFromDisk(now time.Time) {
+	files, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		age := now.Sub(info.ModTime())
+		remove := age >= registryCacheMaxIdle
+		if !remove && age >= c.downloadInfoTTL {
+			var entry cachedResponse
+			data, err := os.ReadFile(file)
+			if err == nil {
+				err = json.Unmarshal(data, &entry)
+			}
+			remove = err != nil || entry.expired(now)
+		}
+		if remove {
+			_ = os.Remove(file)
+		}
+	}
+}
+
+// makes room for one more entry in memory, first by dropping expired entries and then the least recently
+// fetched ones; they stay on disk. Called with c.mu held.
+func (c *responseCache) evictFromMemory(now time.Time) {
+	if len(c.entries) < registryCacheMaxEntries {
+		return
+	}
+	for key, entry := range c.entries {
+		if entry.expired(now) {
+			delete(c.entries, key)
+		}
+	}
+	for len(c.entries) >= registryCacheMaxEntries {
+		oldestKey := ""
+		var oldest time.Time
+		for key, entry := range c.entries {
+			if oldestKey == "" || entry.FetchedAt.Before(oldest) {
+				oldestKey, oldest = key, entry.FetchedAt
+			}
+		}
+		delete(c.entries, oldestKey)
+	}
+}
+
+// how long responses that do not change are reused without a request
+func (c *responseCache) immutableTTL() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.downloadInfoTTL
+}
+
+// the token is part of the key so that what one token may see is not handed out for another, but it is hashed
+// so that it is never written to disk
+func responseCacheKey(u string, token string) string {
+	sum := sha256.Sum256([]byte(u + "\x00" + token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *responseCache) load(key string) (cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, found := c.entries[key]
+	if found || c.dir == "" {
+		return entry, found
+	}
+	data, err := os.ReadFile(filepath.Join(c.dir, key+".json"))
+	if err != nil {
+		return entry, false
+	}
+	err = json.Unmarshal(data, &entry)
+	if err != nil {
+		sugar.Debugf("ignoring unreadable registry cache entry %s: %v", key, err)
+		return entry, false
+	}
+	c.evictFromMemory(time.Now())
+	c.entries[key] = entry
+	return entry, true
+}
+
+func (c *responseCache) store(key string, entry cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, found := c.entries[key]; !found {
+		c.evictFromMemory(time.Now())
+	}
+	c.entries[key] = entry
+	if c.dir == "" {
+		return
+	}
+	// the cache only saves requests, so failing to write it is not worth failing a sync over
+	data, err := json.Marshal(entry)
+	if err == nil {
+		err = os.MkdirAll(c.dir, 0o755)
+	}
+	if err == nil {
+		err = writeFileAtomic(filepath.Join(c.dir, key+".json"), data, 0o644)
+	}
+	if err != nil {
+		sugar.Warnf("error writing registry cache entry for %s: %v", entry.URL, err)
+	}
+}
+
+// drops an entry that turned out to be of no use
+func (c *responseCache) forget(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+	if c.dir != "" {
+		_ = os.Remove(filepath.Join(c.dir, key+".json"))
+	}
+}
+
+// fetches u, answering from the cache if the entry is younger than ttl, and otherwise asking with If-None-Match
+// and If-Modified-Since so that an unchanged response costs a 304. A status other than 200 is returned with
+// no body and no error, for the caller to report.
+func (c *responseCache) get(ctx context.Context, u string, token string, ttl time.Duration) ([]byte, int, error) {
+	key := responseCacheKey(u, token)
+	entry, found := c.load(key)
+	if found && ttl > 0 && time.Since(entry.FetchedAt) < ttl {
+		metricRegistryCache.WithLabelValues("hit").Inc()
+		return entry.Body, http.StatusOK, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	authorizeRegistryRequest(req, token)
+	if found && entry.ETag != "" {
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+	if found && entry.LastModified != "" {
+		req.Header.Set("If-Modified-Since", entry.LastModified)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusNotModified && found {
+		metricRegistryCache.WithLabelValues("revalidated").Inc()
+		entry.FetchedAt = time.Now()
+		entry.TTL = ttl
+		c.store(key, entry)
+		return entry.Body, http.StatusOK, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error reading HTTP response body: %w", err)
+	}
+
+	metricRegistryCache.WithLabelValues("miss").Inc()
+	entry = cachedResponse{
+		URL:          u,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now(),
+		TTL:          ttl,
+		Body:         body,
+	}
+	// a response that can neither be revalidated nor reused would only take up space
+	if entry.ETag != "" || entry.LastModified != "" || ttl > 0 {
+		c.store(key, entry)
+	}
+	return body, http.StatusOK, nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResponseCacheConditionalRequests(t *testing.T) {
+	tests := []struct {
+		name        string
+		setHeaders  func(w http.ResponseWriter)
+		notModified func(r *http.Request) bool
+	}{
+		{
+			"etag",
+			func(w http.ResponseWriter) { w.Header().Set("ETag", `"v1"`) },
+			func(r *http.Request) bool { return r.Header.Get("If-None-Match") == `"v1"` },
+		},
+		{
+			"last modified",
+			func(w http.ResponseWriter) { w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT") },
+			func(r *http.Request) bool {
+				return r.Header.Get("If-Modified-Since") == "Mon, 02 Jan 2006 15:04:05 GMT"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests, fullResponses := 0, 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if tt.notModified(r) {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				fullResponses++
+				tt.setHeaders(w)
+				_, _ = w.Write([]byte(`{"versions":[]}`))
+			}))
+			defer server.Close()
+
+			c := &responseCache{entries: map[string]cachedResponse{}}
+			for i := 0; i < 3; i++ {
+				body, status, err := c.get(t.Context(), server.URL+"/versions", "", 0)
+				if err != nil || status != http.StatusOK || string(body) != `{"versions":[]}` {
+					t.Fatalf("request %d: got %q, %d, %v", i, body, status, err)
+				}
+			}
+			if requests != 3 || fullResponses != 1 {
+				t.Errorf("got %d requests and %d full responses, want 3 and 1", requests, fullResponses)
+			}
+		})
+	}
+}
+
+func TestResponseCacheTTL(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"download_url":"https://example.com/aws.zip"}`))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	c := &responseCache{entries: map[string]cachedResponse{}}
+	c.configure(registryCacheConfig{Dir: dir})
+	u := server.URL + "/download/linux/amd64"
+
+	for i := 0; i < 2; i++ {
+		_, _, err := c.get(t.Context(), u, "token", c.immutableTTL())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("got %d requests within the TTL, want 1", requests)
+	}
+
+	// another token does not get the response fetched with the first one
+	_, _, _ = c.get(t.Context(), u, "other", c.immutableTTL())
+	if requests != 2 {
+		t.Errorf("got %d requests after changing the token, want 2", requests)
+	}
+
+	// a new process with the same directory reuses what is on disk
+	restarted := &responseCache{entries: map[string]cachedResponse{}}
+	restarted.configure(registryCacheConfig{Dir: dir})
+	_, _, _ = restarted.get(t.Context(), u, "token", restarted.immutableTTL())
+	if requests != 2 {
+		t.Errorf("got %d requests after a restart, want 2", requests)
+	}
+
+	restarted.forget(responseCacheKey(u, "token"))
+	_, _, _ = restarted.get(t.Context(), u, "token", restarted.immutableTTL())
+	if requests != 3 {
+		t.Errorf("got %d requests after forgetting the entry, want 3", requests)
+	}
+
+	expired := &responseCache{entries: map[string]cachedResponse{}}
+	expired.configure(registryCacheConfig{Dir: dir, DownloadInfoTTL: -1})
+	_, _, _ = expired.get(t.Context(), u, "token", expired.immutableTTL())
+	if requests != 4 {
+		t.Errorf("got %d requests with the TTL turned off, want 4", requests)
+	}
+	c.configure(registryCacheConfig{})
+	if ttl := c.immutableTTL(); ttl != defaultDownloadInfoTTL {
+		t.Errorf("default TTL = %s, want %s", ttl, defaultDownloadInfoTTL)
+	}
+
+	_, status, err := c.get(t.Context(), server.URL+"/missing", "", time.Hour)
+	if err != nil || status != http.StatusNotFound {
+		t.Errorf("got status %d and error %v, want 404 and no error", status, err)
+	}
+}
+
+func TestResponseCacheEviction(t *testing.T) {
+	now := time.Now()
+
+	t.Run("memory", func(t *testing.T) {
+		c := &responseCache{entries: map[string]cachedResponse{}}
+		for i := 0; i < registryCacheMaxEntries; i++ {
+			c.store(fmt.Sprint(i), cachedResponse{ETag: "x", FetchedAt: now.Add(time.Duration(i) * time.Second)})
+		}
+		c.store("expired", cachedResponse{TTL: time.Hour, FetchedAt: now.Add(-2 * time.Hour)})
+		if len(c.entries) != registryCacheMaxEntries {
+			t.Errorf("got %d entries, want %d", len(c.entries), registryCacheMaxEntries)
+		}
+		if _, found := c.entries["0"]; found {
+			t.Error("expected the least recently fetched entry to be dropped")
+		}
+
+		// expired entries go before anything else
+		c.store("new", cachedResponse{ETag: "x", FetchedAt: now})
+		if _, found := c.entries["expired"]; found {
+			t.Error("expected the expired entry to be dropped")
+		}
+		if _, found := c.entries["1"]; !found || len(c.entries) != registryCacheMaxEntries {
+			t.Errorf("expected only the expired entry to make room, got %d entries", len(c.entries))
+		}
+	})
+
+	t.Run("disk", func(t *testing.T) {
+		dir := t.TempDir()
+		entries := []struct {
+			key      string
+			entry    cachedResponse
+			age      time.Duration
+			wantKept bool
+		}{
+			{"fresh", cachedResponse{TTL: time.Hour}, time.Minute, true},
+			{"expired", cachedResponse{TTL: time.Hour}, 2 * time.Hour, false},
+			{"revalidated", cachedResponse{ETag: "x"}, 48 * time.Hour, true},
+			{"revalidated with a ttl", cachedResponse{ETag: "x", TTL: time.Hour}, 48 * time.Hour, true},
+			{"idle", cachedResponse{ETag: "x"}, registryCacheMaxIdle + time.Hour, false},
+		}
+		for _, e := range entries {
+			e.entry.FetchedAt = now.Add(-e.age)
+			data, err := json.Marshal(e.entry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			file := filepath.Join(dir, e.key+".json")
+			err = os.WriteFile(file, data, 0o644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = os.Chtimes(file, now.Add(-e.age), now.Add(-e.age))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		c := &responseCache{entries: map[string]cachedResponse{}}
+		c.configure(registryCacheConfig{Dir: dir, DownloadInfoTTL: time.Hour})
+		for _, e := range entries {
+			_, err := os.Stat(filepath.Join(dir, e.key+".json"))
+			if kept := err == nil; kept != e.wantKept {
+				t.Errorf("%s: kept = %v, want %v", e.key, kept, e.wantKept)
+			}
+		}
+	})
+}
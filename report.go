@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// summary of a single sync pass, written as JSON when sync is given --report
+type RunReport struct {
+	Mode            string           `json:"mode"`
+	StartedAt       time.Time        `json:"started_at"`
+	FinishedAt      time.Time        `json:"finished_at"`
+	DurationSeconds float64          `json:"duration_seconds"`
+	Interrupted     bool             `json:"interrupted"`
+	Summary         ReportSummary    `json:"summary"`
+	Providers       []ProviderReport `json:"providers"`
+}
+
+// totals over every provider, so that a pipeline can decide on the outcome without walking the whole report
+type ReportSummary struct {
+	Providers       int   `json:"providers"`
+	FailedProviders int   `json:"failed_providers"`
+	Mirrored        int   `json:"mirrored"`
+	Redownloaded    int   `json:"redownloaded"`
+	Skipped         int   `json:"skipped"`
+	Failed          int   `json:"failed"`
+	Excluded        int   `json:"excluded"`
+	Pending         int   `json:"pending"`
+	BytesDownloaded int64 `json:"bytes_downloaded"`
+}
+
+type ProviderReport struct {
+	Provider        string    `json:"provider"`
+	Reference       string    `json:"reference"`
+	Status          string    `json:"status"`
+	Error           string    `json:"error,omitempty"`
+	StartedAt       time.Time `json:"started_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	BytesDownloaded int64     `json:"bytes_downloaded"`
+	// instances that were not in storage before
+	Mirrored []ReportInstance `json:"mirrored"`
+	// instances that were in the catalog but missing from storage or had a bad checksum
+	Redownloaded []ReportInstance `json:"redownloaded"`
+	// instances already in storage with a good checksum, which were not downloaded again
+	Skipped []ReportInstance `json:"skipped"`
+	// instances that could not be mirrored, with the error
+	Failed []ReportInstance `json:"failed"`
+	// instances left out of the index because another platform of the same version failed
+	Excluded []ReportInstance `json:"excluded"`
+	// versions held back because they are younger than min_age
+	Pending []PendingVersion `json:"pending"`
+	// versions listed upstream that are not semantic versions and so could not be considered
+	UnparseableVersions []string `json:"unparseable_versions"`
+}
+
+type ReportInstance struct {
+	Version  string `json:"version"`
+	Platform string `json:"platform"`
+	Size     int64  `json:"size,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+const (
+	reportStatusOK          = "ok"
+	reportStatusFailed      = "failed"
+	reportStatusInterrupted = "interrupted"
+)
+
+func newReportInstance(psi ProviderSpecificInstance) ReportInstance {
+	return ReportInstance{
+		Version:  psi.Version,
+		Platform: fmt.Sprintf("%s_%s", psi.OS, psi.Arch),
+	}
+}
+
+func newReportInstanceFromBinary(psib ProviderSpecificInstanceBinary) ReportInstance {
+	instance := newReportInstance(psib.ProviderSpecificInstance)
+	instance.Size = psib.Size
+	return instance
+}
+
+// instances that were mirrored or kept but are not in the catalog that is written, because their version is incomplete
+func excludedInstances(psibs []ProviderSpecificInstanceBinary, finalPsibs []ProviderSpecificInstanceBinary) []ReportInstance {
+	kept := map[ProviderSpecificInstance]bool{}
+	for _, psib := range finalPsibs {
+		kept[psib.ProviderSpecificInstance] = true
+	}
+	excluded := []ReportInstance{}
+	for _, psib := range psibs {
+		if !kept[psib.ProviderSpecificInstance] {
+			excluded = append(excluded, newReportInstanceFromBinary(psib))
+		}
+	}
+	return excluded
+}
+
+func newProviderReport(configProvider ProviderMirrorConfiguration) ProviderReport {
+	return ProviderReport{
+		Provider:            configProvider.Reference,
+		Reference:           configProvider.Reference,
+		Status:              reportStatusOK,
+		Mirrored:            []ReportInstance{},
+		Redownloaded:        []ReportInstance{},
+		Skipped:             []ReportInstance{},
+		Failed:              []ReportInstance{},
+		Excluded:            []ReportInstance{},
+		Pending:             []PendingVersion{},
+		UnparseableVersions: []string{},
+	}
+}
+
+func (r *RunReport) add(providerReport ProviderReport) {
+	r.Providers = append(r.Providers, providerReport)
+	r.Summary.Providers++
+	if providerReport.Status != reportStatusOK {
+		r.Summary.FailedProviders++
+	}
+	r.Summary.Mirrored += len(providerReport.Mirrored)
+	r.Summary.Redownloaded += len(providerReport.Redownloaded)
+	r.Summary.Skipped += len(providerReport.Skipped)
+	r.Summary.Failed += len(providerReport.Failed)
+	r.Summary.Excluded += len(providerReport.Excluded)
+	r.Summary.Pending += len(providerReport.Pending)
+	r.Summary.BytesDownloaded += providerReport.BytesDownloaded
+}
+
+// writes the report to path, or to stdout if path is "-"
+func writeRunReport(path string, report RunReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return writeFileAtomic(path, data, 0o644)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExcludedInstances(t *testing.T) {
+	psib := func(version, os, arch string, size int64) ProviderSpecificInstanceBinary {
+		return ProviderSpecificInstanceBinary{
+			ProviderSpecificInstance: ProviderSpecificInstance{Version: version, OS: os, Arch: arch},
+			Size:                     size,
+		}
+	}
+	psibs := []ProviderSpecificInstanceBinary{
+		psib("1.0.0", "linux", "amd64", 10),
+		psib("1.1.0", "linux", "amd64", 20),
+		psib("1.1.0", "darwin", "arm64", 30),
+	}
+
+	tests := []struct {
+		name  string
+		final []ProviderSpecificInstanceBinary
+		want  []ReportInstance
+	}{
+		{
+			name:  "nothing excluded",
+			final: psibs,
+			want:  []ReportInstance{},
+		},
+		{
+			name:  "incomplete version excluded",
+			final: psibs[:1],
+			want: []ReportInstance{
+				{Version: "1.1.0", Platform: "linux_amd64", Size: 20},
+				{Version: "1.1.0", Platform: "darwin_arm64", Size: 30},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := excludedInstances(psibs, tt.final)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("instance %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRunReportSummary(t *testing.T) {
+	ok := newProviderReport(ProviderMirrorConfiguration{Reference: "aws"})
+	ok.Mirrored = []ReportInstance{{Version: "1.0.0", Platform: "linux_amd64", Size: 100}}
+	ok.Skipped = []ReportInstance{{Version: "0.9.0", Platform: "linux_amd64"}}
+	ok.BytesDownloaded = 100
+
+	failed := newProviderReport(ProviderMirrorConfiguration{Reference: "random"})
+	failed.Status = reportStatusFailed
+	failed.Error = "failed to mirror 1 instances of provider random"
+	failed.Redownloaded = []ReportInstance{{Version: "2.0.0", Platform: "linux_amd64", Size: 50}}
+	failed.Failed = []ReportInstance{{Version: "2.0.0", Platform: "darwin_arm64", Error: "boom"}}
+	failed.Excluded = []ReportInstance{{Version: "2.0.0", Platform: "linux_amd64", Size: 50}}
+	failed.BytesDownloaded = 50
+
+	var report RunReport
+	report.add(ok)
+	report.add(failed)
+
+	want := ReportSummary{
+		Providers:       2,
+		FailedProviders: 1,
+		Mirrored:        1,
+		Redownloaded:    1,
+		Skipped:         1,
+		Failed:          1,
+		Excluded:        1,
+		BytesDownloaded: 150,
+	}
+	if report.Summary != want {
+		t.Errorf("summary = %+v, want %+v", report.Summary, want)
+	}
+}
+
+func TestWriteRunReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	report := RunReport{Mode: "full", Providers: []ProviderReport{newProviderReport(ProviderMirrorConfiguration{Reference: "aws"})}}
+	report.Summary.Providers = 1
+
+	if err := writeRunReport(path, report); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the lists are always present so that consumers do not have to handle null
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	providers := got["providers"].([]any)
+	provider := providers[0].(map[string]any)
+	for _, key := range []string{"mirrored", "redownloaded", "skipped", "failed", "excluded"} {
+		if _, ok := provider[key].([]any); !ok {
+			t.Errorf("%s = %v, want an empty list", key, provider[key])
+		}
+	}
+	if got["mode"] != "full" {
+		t.Errorf("mode = %v, want full", got["mode"])
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+	// the container image has no zoneinfo, so the timezone database is compiled in for --timezone
+	_ "time/tzdata"
+
+	"github.com/robfig/cron/v3"
+)
+
+// a fixed delay between runs, used when no cron expression is configured
+type intervalSchedule struct {
+	interval time.Duration
+}
+
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(s.interval)
+}
+
+// parses a standard five field cron expression or descriptor such as @daily, evaluated in the given timezone
+func parseSyncSchedule(expression string, timezone string) (cron.Schedule, error) {
+	if timezone != "" && !strings.HasPrefix(expression, "CRON_TZ=") && !strings.HasPrefix(expression, "TZ=") {
+		_, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+		}
+		expression = fmt.Sprintf("CRON_TZ=%s %s", timezone, expression)
+	}
+	schedule, err := cron.ParseStandard(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", expression, err)
+	}
+	return schedule, nil
+}
+
+// keeps track of when the next full sync and the next new-versions-only sync are due
+type syncScheduler struct {
+	full            cron.Schedule
+	newVersions     cron.Schedule // optional
+	jitter          time.Duration
+	nextFull        time.Time
+	nextNewVersions time.Time
+}
+
+func newSyncScheduler(full cron.Schedule, newVersions cron.Schedule, jitter time.Duration, now time.Time) *syncScheduler {
+	s := &syncScheduler{
+		full:        full,
+		newVersions: newVersions,
+		jitter:      jitter,
+	}
+	s.schedule(now)
+	return s
+}
+
+// works out the upcoming run times for whichever schedules have no pending run
+func (s *syncScheduler) schedule(now time.Time) {
+	if !s.nextFull.After(now) {
+		s.nextFull = s.addJitter(s.full.Next(now))
+	}
+	if s.newVersions != nil && !s.nextNewVersions.After(now) {
+		s.nextNewVersions = s.addJitter(s.newVersions.Next(now))
+	}
+}
+
+// returns the time and kind of the next sync; a full sync covers new versions as well, so it wins when both are due
+func (s *syncScheduler) next() (time.Time, SyncOptions) {
+	if s.newVersions != nil && s.nextNewVersions.Before(s.nextFull) {
+		return s.nextNewVersions, SyncOptions{NewVersionsOnly: true}
+	}
+	return s.nextFull, SyncOptions{}
+}
+
+// records that a sync of the given kind has just run; any other run that fell due while it was
+// running is skipped rather than started straight away
+func (s *syncScheduler) ran(opts SyncOptions, now time.Time) {
+	if opts.NewVersionsOnly {
+		s.nextNewVersions = time.Time{}
+	} else {
+		s.nextFull = time.Time{}
+	}
+	s.schedule(now)
+}
+
+// roughly how far apart full syncs are, for deriving staleness thresholds
+func (s *syncScheduler) fullInterval() time.Duration {
+	first := s.full.Next(s.nextFull)
+	return s.full.Next(first).Sub(first) + s.jitter
+}
+
+func (s *syncScheduler) addJitter(t time.Time) time.Time {
+	if s.jitter <= 0 {
+		return t
+	}
+	return t.Add(rand.N(s.jitter))
+}
+
+func syncModeName(opts SyncOptions) string {
+	if opts.NewVersionsOnly {
+		return "new_versions"
+	}
+	return "full"
+}
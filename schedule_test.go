@@ -0,0 +1,124 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSyncSchedule(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		timezone   string
+		after      time.Time
+		expected   time.Time
+		wantErr    bool
+	}{
+		{
+			"nightly in UTC",
+			"0 2 * * *",
+			"UTC",
+			time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+			time.Date(2024, 3, 2, 2, 0, 0, 0, time.UTC),
+			false,
+		},
+		{
+			"nightly in another timezone",
+			"0 2 * * *",
+			"Europe/Berlin",
+			time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+			time.Date(2024, 3, 2, 1, 0, 0, 0, time.UTC),
+			false,
+		},
+		{
+			"descriptor",
+			"@every 30m",
+			"",
+			time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+			time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC),
+			false,
+		},
+		{"invalid expression", "every night", "", time.Time{}, time.Time{}, true},
+		{"invalid timezone", "0 2 * * *", "Mars/Olympus_Mons", time.Time{}, time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := parseSyncSchedule(tt.expression, tt.timezone)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := schedule.Next(tt.after)
+			if !got.Equal(tt.expected) {
+				t.Errorf("Next(%s) = %s, want %s", tt.after, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSyncScheduler(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("full only", func(t *testing.T) {
+		s := newSyncScheduler(intervalSchedule{6 * time.Hour}, nil, 0, start)
+		next, opts := s.next()
+		if !next.Equal(start.Add(6*time.Hour)) || opts.NewVersionsOnly {
+			t.Errorf("got %s %+v, want full sync at %s", next, opts, start.Add(6*time.Hour))
+		}
+	})
+
+	t.Run("quick runs between full syncs", func(t *testing.T) {
+		s := newSyncScheduler(intervalSchedule{6 * time.Hour}, intervalSchedule{time.Hour}, 0, start)
+		next, opts := s.next()
+		if !next.Equal(start.Add(time.Hour)) || !opts.NewVersionsOnly {
+			t.Fatalf("got %s %+v, want new versions sync at %s", next, opts, start.Add(time.Hour))
+		}
+
+		s.ran(opts, next)
+		next, opts = s.next()
+		if !next.Equal(start.Add(2*time.Hour)) || !opts.NewVersionsOnly {
+			t.Errorf("got %s %+v, want new versions sync at %s", next, opts, start.Add(2*time.Hour))
+		}
+	})
+
+	t.Run("full wins a tie", func(t *testing.T) {
+		s := newSyncScheduler(intervalSchedule{time.Hour}, intervalSchedule{time.Hour}, 0, start)
+		_, opts := s.next()
+		if opts.NewVersionsOnly {
+			t.Error("expected the full sync to win when both are due at the same time")
+		}
+	})
+
+	t.Run("overdue runs are rescheduled after a long sync", func(t *testing.T) {
+		s := newSyncScheduler(intervalSchedule{6 * time.Hour}, intervalSchedule{time.Hour}, 0, start)
+		finished := start.Add(6*time.Hour + 3*time.Hour)
+		s.ran(SyncOptions{}, finished)
+		next, opts := s.next()
+		if !next.Equal(finished.Add(time.Hour)) || !opts.NewVersionsOnly {
+			t.Errorf("got %s %+v, want new versions sync at %s", next, opts, finished.Add(time.Hour))
+		}
+	})
+
+	t.Run("jitter stays within bounds", func(t *testing.T) {
+		for range 100 {
+			s := newSyncScheduler(intervalSchedule{time.Hour}, nil, 10*time.Minute, start)
+			next, _ := s.next()
+			if next.Before(start.Add(time.Hour)) || !next.Before(start.Add(time.Hour+10*time.Minute)) {
+				t.Fatalf("jittered time %s out of bounds", next)
+			}
+		}
+	})
+
+	t.Run("full interval", func(t *testing.T) {
+		s := newSyncScheduler(intervalSchedule{6 * time.Hour}, nil, time.Minute, start)
+		if got := s.fullInterval(); got != 6*time.Hour+time.Minute {
+			t.Errorf("fullInterval() = %s, want %s", got, 6*time.Hour+time.Minute)
+		}
+	})
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	semver "github.com/blang/semver/v4"
+)
+
+// where provider versions and archives are mirrored from
+type ProviderSource interface {
+	// lists the available versions and platforms, configProvider may be used to avoid fetching versions that are not wanted
+	GetProviderMetadata(ctx context.Context, provider Provider, configProvider ProviderMirrorConfiguration) (RemoteProviderMetadata, error)
+	// says where to download an instance from and how to check what was downloaded
+	GetDownloadInfo(ctx context.Context, pi ProviderSpecificInstance) (providerDownloadInfo, error)
+}
+
+// implemented by sources that know when a version was released, which network mirrors do not
+type publishedDateSource interface {
+	getPublishedDate(ctx context.Context, provider Provider, version string) (time.Time, error)
+}
+
+type providerDownloadInfo struct {
+	URL string
+	// hex SHA256 of the zip, as given by registries
+	SHA256 string
+	// h1: or zh: hashes of the zip, as given by network mirrors
+	Hashes []string
+	// sent with the download request, only set when URL is on a host that may see it
+	Token string
+	// the registry cache entry this came from, dropped when the download fails in case the URL has expired
+	cacheKey string
+}
+
+func (info providerDownloadInfo) verify(data []byte) error {
+	if info.SHA256 != "" {
+		checksum := fmt.Sprintf("%x", sha256.Sum256(data))
+		if checksum != info.SHA256 {
+			return fmt.Errorf("got SHA %s, expected %s", checksum, info.SHA256)
+		}
+		return nil
+	}
+	if len(info.Hashes) > 0 {
+		return verifyZipHashes(data, info.Hashes)
+	}
+	sugar.Warnf("no hashes to check %s against", info.URL)
+	return nil
+}
+
+// builds the source that a provider stanza mirrors from, the registry the provider belongs to unless it names an upstream
+func newProviderSource(config Configuration, configProvider ProviderMirrorConfiguration, provider Provider) (ProviderSource, error) {
+	if configProvider.Upstream == "" {
+		return registrySource{token: config.registryToken(provider.Hostname)}, nil
+	}
+	upstream, ok := config.Upstreams[configProvider.Upstream]
+	if !ok {
+		return nil, fmt.Errorf("upstream %q is not defined", configProvider.Upstream)
+	}
+	switch upstream.Type {
+	case upstreamTypeNetworkMirror:
+		base, err := url.Parse(upstream.URL)
+		if err != nil {
+			return nil, fmt.Errorf("upstream %s has an invalid url: %w", configProvider.Upstream, err)
+		}
+		return newNetworkMirrorSource(base, config.registryToken(base.Host)), nil
+	}
+	return nil, fmt.Errorf("upstream %s has unknown type %q", configProvider.Upstream, upstream.Type)
+}
+
+// the provider registry protocol of registry.terraform.io, registry.opentofu.org and private registries
+type registrySource struct {
+	token string
+}
+
+func (s registrySource) GetProviderMetadata(ctx context.Context, provider Provider, configProvider ProviderMirrorConfiguration) (RemoteProviderMetadata, error) {
+	metadata, err := provider.GetProviderMetadataFromRegistry(ctx, s.token)
+	if err != nil || configProvider.Keep.ReleasedWithinDays == 0 {
+		return metadata, err
+	}
+	err = s.addPublishedDates(ctx, &metadata, configProvider)
+	return metadata, err
+}
+
+// the versions list has no dates, so they are fetched one version at a time, only for versions in range
+// and only once per process since they never change. Versions whose date cannot be fetched are left without one.
+func (s registrySource) addPublishedDates(ctx context.Context, metadata *RemoteProviderMetadata, configProvider ProviderMirrorConfiguration) error {
+	parsedRange, err := semver.ParseRange(configProvider.VersionRange)
+	if err != nil {
+		return err
+	}
+	missing := 0
+	for i, version := range metadata.Versions {
+		parsed, err := semver.Parse(version.Version)
+		if err != nil || !parsedRange(parsed) {
+			continue
+		}
+		publishedAt, err := s.getPublishedDate(ctx, metadata.Provider, version.Version)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			sugar.Debugf("error fetching publish date of %s %s: %v", metadata.Provider, version.Version, err)
+			missing++
+			continue
+		}
+		metadata.Versions[i].PublishedAt = publishedAt
+	}
+	if missing > 0 {
+		sugar.Warnf("publish date of %d versions of %s is not known, they are kept by released_within_days", missing, metadata.Provider)
+	}
+	return nil
+}
+
+var publishedDates = struct {
+	sync.Mutex
+	dates map[providerVersion]time.Time
+}{dates: map[providerVersion]time.Time{}}
+
+type providerVersion struct {
+	Provider
+	Version string
+}
+
+func (s registrySource) getPublishedDate(ctx context.Context, provider Provider, version string) (time.Time, error) {
+	key := providerVersion{Provider: provider, Version: version}
+	publishedDates.Lock()
+	publishedAt, ok := publishedDates.dates[key]
+	publishedDates.Unlock()
+	if ok {
+		return publishedAt, nil
+	}
+
+	versionURL := fmt.Sprintf("%s%s/%s/%s", providersAPIBase(ctx, provider.Hostname, s.token), provider.Owner, provider.Name, version)
+	body, status, err := registryResponses.get(ctx, versionURL, s.token, registryResponses.immutableTTL())
+	if err != nil {
+		return publishedAt, err
+	}
+	if status != http.StatusOK {
+		return publishedAt, fmt.Errorf("HTTP %d from registry", status)
+	}
+	var details HCTFProviderVersionDetails
+	err = json.Unmarshal(body, &details)
+	if err != nil {
+		return publishedAt, fmt.Errorf("error unmarshalling response body: %w", err)
+	}
+	if details.PublishedAt.IsZero() {
+		return publishedAt, fmt.Errorf("registry did not say when it was published")
+	}
+
+	publishedDates.Lock()
+	publishedDates.dates[key] = details.PublishedAt
+	publishedDates.Unlock()
+	return details.PublishedAt, nil
+}
+
+func (s registrySource) GetDownloadInfo(ctx context.Context, pi ProviderSpecificInstance) (providerDownloadInfo, error) {
+	var info providerDownloadInfo
+	downloadResponseUrl := fmt.Sprintf("%s%s/%s/%s/download/%s/%s", providersAPIBase(ctx, pi.Hostname, s.token), pi.Owner, pi.Name, pi.Version, pi.OS, pi.Arch)
+
+	respBody, status, err := registryResponses.get(ctx, downloadResponseUrl, s.token, registryResponses.immutableTTL())
+	if err != nil {
+		return info, err
+	}
+	if status != http.StatusOK {
+		return info, fmt.Errorf("HTTP %d from registry for PVI %s", status, pi)
+	}
+
+	var registryDownloadResponse HCTFRegistryDownloadResponse
+	err = json.Unmarshal(respBody, &registryDownloadResponse)
+	if err != nil {
+		return info, fmt.Errorf("error unmarshalling response body: %w", err)
+	}
+
+	info.URL = registryDownloadResponse.DownloadURL
+	info.SHA256 = registryDownloadResponse.Shasum
+	info.cacheKey = responseCacheKey(downloadResponseUrl, s.token)
+	downloadURL, err := url.Parse(info.URL)
+	if err == nil && sameHost(downloadURL, pi.Hostname) {
+		info.Token = s.token
+	}
+	return info, nil
+}
+
+// another provider network mirror, such as one written by tfspiegel or `terraform providers mirror` and served
+// over HTTPS. The mirror is laid out as <base>/<hostname>/<namespace>/<type>/index.json and <version>.json.
+type networkMirrorSource struct {
+	base  *url.URL
+	token string
+
+	// the version documents fetched while listing versions, so that downloads do not fetch them again
+	mu       sync.Mutex
+	archives map[string]MirrorArchives
+}
+
+func newNetworkMirrorSource(base *url.URL, token string) *networkMirrorSource {
+	if !strings.HasSuffix(base.Path, "/") {
+		copied := *base
+		copied.Path += "/"
+		base = &copied
+	}
+	return &networkMirrorSource{
+		base:     base,
+		token:    token,
+		archives: map[string]MirrorArchives{},
+	}
+}
+
+func (s *networkMirrorSource) providerURL(provider Provider, file string) *url.URL {
+	return s.base.ResolveReference(&url.URL{Path: fmt.Sprintf("%s/%s/%s/%s", provider.Hostname, provider.Owner, provider.Name, file)})
+}
+
+func (s *networkMirrorSource) getJSON(ctx context.Context, u *url.URL, into any) error {
+	// a mirror's documents can be rewritten at any time, so they are always revalidated
+	body, status, err := registryResponses.get(ctx, u.String(), s.token, 0)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("HTTP %d fetching %s", status, u)
+	}
+	err = json.Unmarshal(body, into)
+	if err != nil {
+		return fmt.Errorf("error unmarshalling %s: %w", u, err)
+	}
+	return nil
+}
+
+func (s *networkMirrorSource) GetProviderMetadata(ctx context.Context, provider Provider, configProvider ProviderMirrorConfiguration) (RemoteProviderMetadata, error) {
+	metadata := RemoteProviderMetadata{Provider: provider}
+
+	var index MirrorIndex
+	err := s.getJSON(ctx, s.providerURL(provider, mirrorIndexFile), &index)
+	if err != nil {
+		return metadata, fmt.Errorf("error fetching mirror index for provider %s: %w", provider, err)
+	}
+
+	// the platforms of a version are only in its own document, so only the versions in range are fetched
+	versionRange, err := semver.ParseRange(configProvider.VersionRange)
+	if err != nil {
+		return metadata, err
+	}
+	for version := range index.Versions {
+		parsed, err := semver.Parse(version)
+		if err != nil || !versionRange(parsed) {
+			continue
+		}
+
+		var archives MirrorArchives
+		err = s.getJSON(ctx, s.providerURL(provider, version+".json"), &archives)
+		if err != nil {
+			return metadata, fmt.Errorf("error fetching mirror archives for provider %s %s: %w", provider, version, err)
+		}
+		s.mu.Lock()
+		s.archives[version] = archives
+		s.mu.Unlock()
+
+		providerVersion := HCTFProviderVersion{Version: version}
+		for platform := range archives.Archives {
+			os, arch, found := strings.Cut(platform, "_")
+			if !found {
+				sugar.Warnf("ignoring platform %q of provider %s %s in mirror", platform, provider, version)
+				continue
+			}
+			providerVersion.Platforms = append(providerVersion.Platforms, HCTFProviderPlatform{OS: os, Arch: arch})
+		}
+		metadata.Versions = append(metadata.Versions, providerVersion)
+	}
+
+	return metadata, nil
+}
+
+func (s *networkMirrorSource) GetDownloadInfo(ctx context.Context, pi ProviderSpecificInstance) (providerDownloadInfo, error) {
+	var info providerDownloadInfo
+
+	s.mu.Lock()
+	archives, ok := s.archives[pi.Version]
+	s.mu.Unlock()
+	versionURL := s.providerURL(pi.Provider, pi.Version+".json")
+	if !ok {
+		err := s.getJSON(ctx, versionURL, &archives)
+		if err != nil {
+			return info, err
+		}
+	}
+
+	archive, ok := archives.Archives[fmt.Sprintf("%s_%s", pi.OS, pi.Arch)]
+	if !ok {
+		return info, fmt.Errorf("mirror has no %s_%s archive for %s %s", pi.OS, pi.Arch, pi.Provider, pi.Version)
+	}
+	// archive URLs are relative to the version document unless they are absolute
+	archiveURL, err := versionURL.Parse(archive.URL)
+	if err != nil {
+		return info, fmt.Errorf("invalid archive url %q: %w", archive.URL, err)
+	}
+
+	info.URL = archiveURL.String()
+	info.Hashes = archive.Hashes
+	if sameHost(archiveURL, s.base.Host) {
+		info.Token = s.token
+	}
+	return info, nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"testing"
+	"time"
+)
+
+// serves a network mirror of hashicorp/aws with versions 4.0.0 and 5.0.0 under /mirror/
+func newTestNetworkMirror(t *testing.T, zipBytes []byte, hashes []string) (*httptest.Server, *int) {
+	t.Helper()
+	versionRequests := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/mirror/registry.terraform.io/hashicorp/aws/index.json":
+			_ = json.NewEncoder(w).Encode(MirrorIndex{Versions: map[string]map[string]any{"4.0.0": {}, "5.0.0": {}}})
+		case "/mirror/registry.terraform.io/hashicorp/aws/4.0.0.json", "/mirror/registry.terraform.io/hashicorp/aws/5.0.0.json":
+			versionRequests++
+			_ = json.NewEncoder(w).Encode(MirrorArchives{Archives: map[string]MirrorProviderPlatformArch{
+				"linux_amd64":  {URL: "terraform-provider-aws_linux_amd64.zip", Hashes: hashes},
+				"darwin_arm64": {URL: "/elsewhere/terraform-provider-aws_darwin_arm64.zip", Hashes: hashes},
+			}})
+		case "/mirror/registry.terraform.io/hashicorp/aws/terraform-provider-aws_linux_amd64.zip", "/elsewhere/terraform-provider-aws_darwin_arm64.zip":
+			_, _ = w.Write(zipBytes)
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &versionRequests
+}
+
+func TestNetworkMirrorSourceGetProviderMetadata(t *testing.T) {
+	zipBytes, h1 := createTestZip(t, "terraform-provider-aws", "binary")
+	server, versionRequests := newTestNetworkMirror(t, zipBytes, []string{h1})
+	oldClient := httpClient
+	httpClient = server.Client()
+	defer func() { httpClient = oldClient }()
+
+	base, _ := url.Parse(server.URL + "/mirror")
+	source := newNetworkMirrorSource(base, "")
+	metadata, err := source.GetProviderMetadata(t.Context(), testProvider(), ProviderMirrorConfiguration{Reference: "aws", VersionRange: ">=5.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(metadata.Versions) != 1 || metadata.Versions[0].Version != "5.0.0" {
+		t.Fatalf("versions = %+v, want only 5.0.0", metadata.Versions)
+	}
+	var platforms []string
+	for _, platform := range metadata.Versions[0].Platforms {
+		platforms = append(platforms, platform.String())
+	}
+	sort.Strings(platforms)
+	if fmt.Sprint(platforms) != "[darwin_arm64 linux_amd64]" {
+		t.Errorf("platforms = %v", platforms)
+	}
+	if *versionRequests != 1 {
+		t.Errorf("fetched %d version documents, want only the one in range", *versionRequests)
+	}
+}
+
+func TestRegistrySourcePublishedDates(t *testing.T) {
+	published := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	detailRequests := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/providers/hashicorp/aws/versions":
+			_, _ = w.Write([]byte(`{"versions": [{"version": "4.0.0"}, {"version": "5.0.0"}, {"version": "5.1.0"}]}`))
+		case "/v1/providers/hashicorp/aws/5.0.0":
+			detailRequests++
+			_, _ = fmt.Fprintf(w, `{"version": "5.0.0", "published_at": %q}`, published.Format(time.RFC3339))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+	oldClient := httpClient
+	httpClient = server.Client()
+	defer func() { httpClient = oldClient }()
+
+	provider := Provider{Hostname: server.URL[len("https://"):], Owner: "hashicorp", Name: "aws"}
+	configProvider := ProviderMirrorConfiguration{Reference: "aws", VersionRange: ">=5.0.0", Keep: versionPolicyConfig{ReleasedWithinDays: 30}}
+	for range 2 {
+		metadata, err := registrySource{}.GetProviderMetadata(t.Context(), provider, configProvider)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dates := map[string]time.Time{}
+		for _, version := range metadata.Versions {
+			dates[version.Version] = version.PublishedAt
+		}
+		if !dates["5.0.0"].Equal(published) {
+			t.Errorf("5.0.0 published at %s, want %s", dates["5.0.0"], published)
+		}
+		if !dates["4.0.0"].IsZero() || !dates["5.1.0"].IsZero() {
+			t.Errorf("expected no date for versions out of range or unknown to the registry, got %v", dates)
+		}
+	}
+	if detailRequests != 1 {
+		t.Errorf("fetched the publish date %d times, want it cached after the first", detailRequests)
+	}
+}
+
+func TestNetworkMirrorSourceDownload(t *testing.T) {
+	zipBytes, h1 := createTestZip(t, "terraform-provider-aws", "binary")
+	_, otherH1 := createTestZip(t, "terraform-provider-aws", "something else")
+
+	tests := []struct {
+		name     string
+		hashes   []string
+		platform HCTFProviderPlatform
+		wantErr  bool
+	}{
+		{"relative archive url", []string{h1}, HCTFProviderPlatform{OS: "linux", Arch: "amd64"}, false},
+		{"absolute path archive url", []string{h1}, HCTFProviderPlatform{OS: "darwin", Arch: "arm64"}, false},
+		{"hash mismatch", []string{otherH1}, HCTFProviderPlatform{OS: "linux", Arch: "amd64"}, true},
+		{"platform not in mirror", []string{h1}, HCTFProviderPlatform{OS: "windows", Arch: "amd64"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, versionRequests := newTestNetworkMirror(t, zipBytes, tt.hashes)
+			oldClient := httpClient
+			httpClient = server.Client()
+			defer func() { httpClient = oldClient }()
+			oldSleep := retrySleep
+			retrySleep = func(ctx context.Context, retries int, backoff time.Duration) {}
+			defer func() { retrySleep = oldSleep }()
+
+			base, _ := url.Parse(server.URL + "/mirror/")
+			source := newNetworkMirrorSource(base, "")
+			pi := ProviderSpecificInstance{Provider: testProvider(), Version: "5.0.0", OS: tt.platform.OS, Arch: tt.platform.Arch}
+
+			var written []byte
+			mock := mockProviderStorer{
+				writeProviderBinaryDataToStorageFunc: func(data []byte, p ProviderSpecificInstance) (*ProviderSpecificInstanceBinary, error) {
+					written = data
+					return &ProviderSpecificInstanceBinary{ProviderSpecificInstance: p}, nil
+				},
+			}
+			d := ProviderDownloader{Storage: mock, Source: source}
+			_, err := d.MirrorProviderInstanceToDest(t.Context(), pi)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MirrorProviderInstanceToDest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(written) != string(zipBytes) {
+				t.Errorf("wrong data written to storage")
+			}
+			if *versionRequests == 0 {
+				t.Errorf("version document was not fetched")
+			}
+		})
+	}
+}
+
+func TestNewProviderSource(t *testing.T) {
+	config := Configuration{Upstreams: map[string]upstreamConfig{
+		"central": {Type: upstreamTypeNetworkMirror, URL: "https://mirror.example.com/providers/"},
+	}}
+
+	source, err := newProviderSource(config, ProviderMirrorConfiguration{Reference: "aws"}, testProvider())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := source.(registrySource); !ok {
+		t.Errorf("got %T without an upstream, want registrySource", source)
+	}
+
+	source, err = newProviderSource(config, ProviderMirrorConfiguration{Reference: "aws", Upstream: "central"}, testProvider())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mirror, ok := source.(*networkMirrorSource)
+	if !ok {
+		t.Fatalf("got %T, want *networkMirrorSource", source)
+	}
+	if got := mirror.providerURL(testProvider(), "index.json").String(); got != "https://mirror.example.com/providers/registry.terraform.io/hashicorp/aws/index.json" {
+		t.Errorf("index url = %s", got)
+	}
+
+	_, err = newProviderSource(config, ProviderMirrorConfiguration{Reference: "aws", Upstream: "missing"}, testProvider())
+	if err == nil {
+		t.Error("expected an error for an undefined upstream")
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// folds the stanzas that ask for the same provider into the first one, so that the provider is synced once and
+// its catalog has everything any of them wants. The order of first appearance is kept.
+func mergeProviderStanzas(config Configuration, configProviders []ProviderMirrorConfiguration) []ProviderMirrorConfiguration {
+	var merged []ProviderMirrorConfiguration
+	index := make(map[string]int)
+	for _, configProvider := range configProviders {
+		key := configProvider.Reference
+		if provider, err := config.NewProvider(configProvider.Reference); err == nil {
+			key = provider.String()
+		}
+		i, found := index[key]
+		if !found {
+			index[key] = len(merged)
+			merged = append(merged, configProvider)
+			continue
+		}
+		merged[i].merged = append(merged[i].merged, configProvider)
+	}
+	return merged
+}
+
+// the stanza itself followed by the ones merged into it
+func (c ProviderMirrorConfiguration) stanzas() []ProviderMirrorConfiguration {
+	stanzas := []ProviderMirrorConfiguration{c}
+	for _, stanza := range c.merged {
+		stanza.merged = nil
+		stanzas = append(stanzas, stanza)
+	}
+	stanzas[0].merged = nil
+	return stanzas
+}
+
+// what upstream is asked for: the versions in the range of any of the stanzas, with publish dates if any
+// of them needs them
+func (c ProviderMirrorConfiguration) upstreamQuery() ProviderMirrorConfiguration {
+	if len(c.merged) == 0 {
+		return c
+	}
+	query := c
+	var ranges []string
+	for _, stanza := range c.stanzas() {
+		ranges = append(ranges, stanza.VersionRange)
+		query.Keep.ReleasedWithinDays = max(query.Keep.ReleasedWithinDays, stanza.Keep.ReleasedWithinDays)
+	}
+	// || binds loosest in blang/semver ranges, so this is the union of the ranges as they are
+	query.VersionRange = strings.Join(ranges, " || ")
+	query.merged = nil
+	return query
+}
+
+// the instances that any of the stanzas for a provider wants, each listed once
+func (p Provider) wantedInstances(providerMetadata RemoteProviderMetadata, configProvider ProviderMirrorConfiguration) ([]ProviderSpecificInstance, error) {
+	var wanted []ProviderSpecificInstance
+	added := make(map[ProviderSpecificInstance]bool)
+	for _, stanza := range configProvider.stanzas() {
+		instances, err := p.FilterToWantedPVIs(providerMetadata, stanza, wantedOSArchs(stanza, p))
+		if err != nil {
+			return nil, err
+		}
+		for _, instance := range instances {
+			if !added[instance] {
+				added[instance] = true
+				wanted = append(wanted, instance)
+			}
+		}
+	}
+	return wanted, nil
+}
+
+// the settings that apply to a provider's sync as a whole, which stanzas for the same provider cannot disagree on
+func conflictingStanzaSettings(a ProviderMirrorConfiguration, b ProviderMirrorConfiguration) []string {
+	var conflicts []string
+	if a.Upstream != b.Upstream {
+		conflicts = append(conflicts, fmt.Sprintf("upstream (%q and %q)", a.Upstream, b.Upstream))
+	}
+	if a.MinAge != b.MinAge {
+		conflicts = append(conflicts, fmt.Sprintf("min_age (%s and %s)", a.MinAge, b.MinAge))
+	}
+	if !reflect.DeepEqual(a.Retry, b.Retry) {
+		conflicts = append(conflicts, "retry")
+	}
+	if !reflect.DeepEqual(a.Verification, b.Verification) {
+		conflicts = append(conflicts, "verification")
+	}
+	return conflicts
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeProviderStanzas(t *testing.T) {
+	config, err := parseConfig([]byte(`
+storage_type: fs
+fs_config:
+  download_root: /tmp/mirror
+defaults:
+  os_archs: [linux_amd64]
+providers:
+  - reference: aws
+    version_range: ">=5.0.0"
+  - reference: random
+    version_range: ">=3.0.0"
+  - reference: registry.terraform.io/hashicorp/aws
+    version_range: ">=4.0.0 <4.5.0 || 4.67.0"
+    os_archs: [darwin_arm64]
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(config.Providers) != 2 {
+		t.Fatalf("got %d providers, want 2", len(config.Providers))
+	}
+	aws := config.Providers[0]
+	if aws.Reference != "aws" || len(aws.stanzas()) != 2 || config.Providers[1].Reference != "random" {
+		t.Fatalf("unexpected providers %+v", config.Providers)
+	}
+	if got := aws.upstreamQuery().VersionRange; got != ">=5.0.0 || >=4.0.0 <4.5.0 || 4.67.0" {
+		t.Errorf("unexpected upstream query range %q", got)
+	}
+
+	p := Provider{Hostname: "registry.terraform.io", Owner: "hashicorp", Name: "aws"}
+	linux := HCTFProviderPlatform{OS: "linux", Arch: "amd64"}
+	darwin := HCTFProviderPlatform{OS: "darwin", Arch: "arm64"}
+	metadata := RemoteProviderMetadata{
+		Provider: p,
+		Versions: []HCTFProviderVersion{
+			{Version: "4.0.0", Platforms: []HCTFProviderPlatform{linux, darwin}},
+			{Version: "4.67.0", Platforms: []HCTFProviderPlatform{linux, darwin}},
+			{Version: "5.0.0", Platforms: []HCTFProviderPlatform{linux, darwin}},
+		},
+	}
+	wanted, err := p.wantedInstances(metadata, aws)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []string
+	for _, pi := range wanted {
+		got = append(got, pi.Version+" "+pi.OS+"_"+pi.Arch)
+	}
+	want := []string{"5.0.0 linux_amd64", "4.0.0 darwin_arm64", "4.67.0 darwin_arm64"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestMergeProviderStanzasOverlapping(t *testing.T) {
+	p := Provider{Hostname: "registry.terraform.io", Owner: "hashicorp", Name: "aws"}
+	platforms := []HCTFProviderPlatform{{OS: "linux", Arch: "amd64"}}
+	metadata := RemoteProviderMetadata{
+		Provider: p,
+		Versions: []HCTFProviderVersion{
+			{Version: "5.0.0", Platforms: platforms},
+			{Version: "5.1.0", Platforms: platforms},
+		},
+	}
+	configProvider := ProviderMirrorConfiguration{
+		Reference:    "aws",
+		VersionRange: ">=5.0.0",
+		OSArchs:      platforms,
+		merged:       []ProviderMirrorConfiguration{{Reference: "aws", VersionRange: "5.1.0", OSArchs: platforms}},
+	}
+	wanted, err := p.wantedInstances(metadata, configProvider)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(wanted) != 2 {
+		t.Errorf("instances wanted by both stanzas should be listed once, got %v", wanted)
+	}
+}
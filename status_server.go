@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func newStatusHandler(checks healthChecks) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", checks.healthz)
+	mux.HandleFunc("/readyz", checks.readyz)
+	return mux
+}
+
+// starts the HTTP listener that exposes metrics and health checks while syncing; the listen happens up front so that
+// a bad address or a port that is already taken fails the command instead of being logged and forgotten
+func startStatusServer(listenAddress string, checks healthChecks) (*http.Server, error) {
+	listener, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	server := &http.Server{
+		Handler:           newStatusHandler(checks),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			sugar.Errorf("status server stopped: %v", err)
+		}
+	}()
+	sugar.Infof("serving metrics and health checks on %s", listener.Addr())
+
+	return server, nil
+}
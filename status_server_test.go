@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusHandlerMetrics(t *testing.T) {
+	metricDownloadsAttempted.WithLabelValues("registry.terraform.io/hashicorp/metricstest", "linux_amd64").Inc()
+
+	server := httptest.NewServer(newStatusHandler(healthChecks{status: &syncStatus{}}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `tfspiegel_downloads_attempted_total{platform="linux_amd64",provider="registry.terraform.io/hashicorp/metricstest"} 1`
+	if !strings.Contains(string(body), expected) {
+		t.Errorf("metrics output does not contain %q", expected)
+	}
+}
+
+func TestStartStatusServerBadAddress(t *testing.T) {
+	_, err := startStatusServer("not an address", healthChecks{status: &syncStatus{}})
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestStatusHandlerHealthEndpoints(t *testing.T) {
+	status := &syncStatus{}
+	status.progress()
+	root := t.TempDir()
+	checks := healthChecks{
+		status:          status,
+		livenessTimeout: time.Hour,
+		readinessMaxAge: time.Hour,
+		destination: func() DownloadDestination {
+			return DownloadDestination{Type: STORAGE_TYPE_FS, FSConfig: fsConfig{DownloadRoot: root}}
+		},
+		storage: newStorageProbe(),
+	}
+	server := httptest.NewServer(newStatusHandler(checks))
+	defer server.Close()
+
+	get := func(path string) int {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := get("/healthz"); code != http.StatusOK {
+		t.Errorf("/healthz = %d, want 200", code)
+	}
+	if code := get("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz before first sync = %d, want 503", code)
+	}
+
+	status.finished()
+	if code := get("/readyz"); code != http.StatusOK {
+		t.Errorf("/readyz after sync = %d, want 200", code)
+	}
+}
@@ -1,5 +1,96 @@
 package main
 
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// builds the storage backend for a single provider from the configured download destination
+func NewProviderStorer(ctx context.Context, destination DownloadDestination, provider Provider, wantedProviderInstances []ProviderSpecificInstance) (ProviderStorer, error) {
+	switch destination.Type {
+	case STORAGE_TYPE_FS:
+		return FSProviderStorageConfiguration{
+			downloadRoot:            destination.FSConfig.DownloadRoot,
+			layout:                  destination.FSConfig.Layout,
+			provider:                provider,
+			sugar:                   sugar,
+			wantedProviderInstances: wantedProviderInstances,
+		}, nil
+	case STORAGE_TYPE_S3:
+		s3client, err := newS3Client(ctx, destination.S3Config)
+		if err != nil {
+			return nil, err
+		}
+
+		return S3ProviderStorageConfiguration{
+			bucket:                  destination.S3Config.Bucket,
+			context:                 ctx,
+			prefix:                  destination.S3Config.Prefix,
+			provider:                provider,
+			s3client:                *s3client,
+			sugar:                   sugar,
+			wantedProviderInstances: wantedProviderInstances,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown storage type %d", destination.Type)
+}
+
+// checks that the storage backend can be reached at all, without looking at any particular provider
+func CheckStorageReachable(ctx context.Context, destination DownloadDestination) error {
+	check, err := newStorageReachabilityCheck(ctx, destination)
+	if err != nil {
+		return err
+	}
+	return check(ctx)
+}
+
+// lists the providers that have a catalog in storage, whether they are in the config or not
+func ListStoredProviders(ctx context.Context, destination DownloadDestination) ([]Provider, error) {
+	switch destination.Type {
+	case STORAGE_TYPE_FS:
+		return listFSStoredProviders(destination.FSConfig)
+	case STORAGE_TYPE_S3:
+		return listS3StoredProviders(ctx, destination.S3Config)
+	}
+
+	return nil, fmt.Errorf("unknown storage type %d", destination.Type)
+}
+
+// the provider whose catalog index is at a path below the storage root, which is HOSTNAME/OWNER/NAME/index.json
+// in every layout
+func providerFromIndexPath(indexPath string) (Provider, bool) {
+	parts := strings.Split(indexPath, "/")
+	if len(parts) != 4 || parts[3] != mirrorIndexFile {
+		return Provider{}, false
+	}
+	for _, part := range parts[:3] {
+		if strings.HasPrefix(part, ".") {
+			return Provider{}, false
+		}
+	}
+	provider := Provider{Hostname: parts[0], Owner: parts[1], Name: parts[2]}
+	if provider.validateAddress() != nil {
+		return Provider{}, false
+	}
+	return provider, true
+}
+
+// like CheckStorageReachable, but the client is only made once, so that the check can be repeated cheaply
+func newStorageReachabilityCheck(ctx context.Context, destination DownloadDestination) (func(context.Context) error, error) {
+	switch destination.Type {
+	case STORAGE_TYPE_FS:
+		return func(context.Context) error {
+			return checkFSStorageReachable(destination.FSConfig)
+		}, nil
+	case STORAGE_TYPE_S3:
+		return newS3ReachabilityCheck(ctx, destination.S3Config)
+	}
+
+	return nil, fmt.Errorf("unknown storage type %d", destination.Type)
+}
+
 func commonReconcileWantedProviderInstances(
 	validPSIBs []ProviderSpecificInstanceBinary,
 	invalidPSIBs []ProviderSpecificInstanceBinary,
@@ -23,3 +114,55 @@ func commonReconcileWantedProviderInstances(
 	}
 	return retval
 }
+
+// groups binaries by version into the index and the per-version archive documents of the network mirror protocol
+func commonBuildMirrorCatalog(psibs []ProviderSpecificInstanceBinary) (MirrorIndex, map[string]MirrorArchives) {
+	mirrorIndex := MirrorIndex{
+		Versions: make(map[string]map[string]any),
+	}
+	versionArchives := make(map[string]MirrorArchives)
+
+	for _, psib := range psibs {
+		if _, ok := versionArchives[psib.Version]; !ok {
+			versionArchives[psib.Version] = MirrorArchives{
+				Archives: make(map[string]MirrorProviderPlatformArch),
+			}
+			mirrorIndex.Versions[psib.Version] = make(map[string]any)
+		}
+		osArch := fmt.Sprintf("%s_%s", psib.OS, psib.Arch)
+		versionArchives[psib.Version].Archives[osArch] = MirrorProviderPlatformArch{
+			Hashes: []string{psib.H1Checksum},
+			URL:    psib.GetDownloadedFileName(),
+		}
+	}
+
+	return mirrorIndex, versionArchives
+}
+
+// collects the metadata of each binary, keyed by file name
+func commonBuildCatalogMetadata(psibs []ProviderSpecificInstanceBinary) CatalogMetadata {
+	metadata := CatalogMetadata{
+		Binaries: make(map[string]BinaryMetadata),
+	}
+	for _, psib := range psibs {
+		metadata.Binaries[psib.GetDownloadedFileName()] = BinaryMetadata{
+			Size:        psib.Size,
+			MirroredAt:  psib.MirroredAt,
+			PublishedAt: psib.PublishedAt,
+		}
+	}
+	return metadata
+}
+
+// fills in the metadata fields of catalog entries that were loaded from the mirror protocol documents
+func commonApplyCatalogMetadata(psibs []ProviderSpecificInstanceBinary, metadata CatalogMetadata) {
+	for i := range psibs {
+		binaryMetadata, ok := metadata.Binaries[psibs[i].GetDownloadedFileName()]
+		if !ok {
+			continue
+		}
+		psibs[i].Size = binaryMetadata.Size
+		psibs[i].MirroredAt = binaryMetadata.MirroredAt
+		psibs[i].PublishedAt = binaryMetadata.PublishedAt
+	}
+}
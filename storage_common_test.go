@@ -117,3 +117,23 @@ func TestCommonReconcileWantedProviderInstances(t *testing.T) {
 		})
 	}
 }
+
+func TestProviderFromIndexPath(t *testing.T) {
+	tests := []struct {
+		indexPath string
+		want      Provider
+		wantOK    bool
+	}{
+		{"registry.terraform.io/hashicorp/aws/index.json", Provider{Hostname: "registry.terraform.io", Owner: "hashicorp", Name: "aws"}, true},
+		{"registry.terraform.io/hashicorp/aws/5.0.0.json", Provider{}, false},
+		{"registry.terraform.io/hashicorp/index.json", Provider{}, false},
+		{"registry.terraform.io/hashicorp/aws/5.0.0/index.json", Provider{}, false},
+		{".quarantine/hashicorp/aws/index.json", Provider{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := providerFromIndexPath(tt.indexPath)
+		if ok != tt.wantOK || got != tt.want {
+			t.Errorf("providerFromIndexPath(%q) = %v, %v, want %v, %v", tt.indexPath, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
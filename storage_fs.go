@@ -2,14 +2,44 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"golang.org/x/mod/sumdb/dirhash"
 )
 
+func checkFSStorageReachable(config fsConfig) error {
+	info, err := os.Stat(config.DownloadRoot)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", config.DownloadRoot)
+	}
+	return nil
+}
+
+func listFSStoredProviders(config fsConfig) ([]Provider, error) {
+	// fs.Glob rather than filepath.Glob, so that pattern characters in the root are taken literally
+	indexPaths, err := fs.Glob(os.DirFS(config.DownloadRoot), path.Join("*", "*", "*", mirrorIndexFile))
+	if err != nil {
+		return nil, err
+	}
+	var providers []Provider
+	for _, indexPath := range indexPaths {
+		if provider, ok := providerFromIndexPath(indexPath); ok {
+			providers = append(providers, provider)
+		}
+	}
+	return providers, nil
+}
+
 // for filesystem mirroring we use the Terraform mirror index and the individual JSON files as the catalog
 func (s FSProviderStorageConfiguration) LoadCatalog() ([]ProviderSpecificInstanceBinary, error) {
 	indexFullPath := filepath.Join(s.downloadRoot, s.provider.String(), mirrorIndexFile)
@@ -67,6 +97,21 @@ func (s FSProviderStorageConfiguration) LoadCatalog() ([]ProviderSpecificInstanc
 		}
 	}
 
+	// older mirrors won't have the metadata file, which only means that sizes and timestamps are unknown
+	metadataFullPath := filepath.Join(s.downloadRoot, s.provider.String(), catalogMetadataFile)
+	metadataContents, err := os.ReadFile(metadataFullPath)
+	if err != nil {
+		s.sugar.Debugf("unable to read catalog metadata file %s: %v", metadataFullPath, err)
+		return psibs, nil
+	}
+	var metadata CatalogMetadata
+	err = json.Unmarshal(metadataContents, &metadata)
+	if err != nil {
+		s.sugar.Errorf("unable to unmarshal catalog metadata file %s: %v", metadataFullPath, err)
+		return psibs, nil
+	}
+	commonApplyCatalogMetadata(psibs, metadata)
+
 	return psibs, nil
 }
 
@@ -81,7 +126,12 @@ func (s FSProviderStorageConfiguration) VerifyCatalogAgainstStorage(
 
 	for _, pib := range catalog {
 		s.sugar.Debugf("verifying catalog entry %s", pib.FullPath)
-		hash, err := dirhash.HashZip(pib.FullPath, dirhash.Hash1)
+		var hash string
+		if s.layout == fsLayoutUnpacked {
+			hash, err = hashUnpackedDir(pib.FullPath)
+		} else {
+			hash, err = dirhash.HashZip(pib.FullPath, dirhash.Hash1)
+		}
 		if err != nil {
 			s.sugar.Debugf("err: %v", err)
 			invalidLocalBinaries = append(invalidLocalBinaries, pib)
@@ -114,6 +164,10 @@ func (s FSProviderStorageConfiguration) WriteProviderBinaryDataToStorage(
 	binaryData []byte,
 	pi ProviderSpecificInstance,
 ) (psib *ProviderSpecificInstanceBinary, err error) {
+	if s.layout == fsLayoutUnpacked {
+		return s.writeUnpacked(binaryData, pi)
+	}
+
 	dirPath := filepath.Join(s.downloadRoot, pi.GetDownloadBase())
 	err = os.MkdirAll(dirPath, os.FileMode(0755))
 	if err != nil {
@@ -121,7 +175,7 @@ func (s FSProviderStorageConfiguration) WriteProviderBinaryDataToStorage(
 	}
 
 	fullPath := filepath.Join(dirPath, pi.GetDownloadedFileName())
-	err = os.WriteFile(fullPath, binaryData, os.FileMode(0644))
+	err = writeFileAtomic(fullPath, binaryData, os.FileMode(0644))
 	if err != nil {
 		return nil, err
 	}
@@ -135,55 +189,139 @@ func (s FSProviderStorageConfiguration) WriteProviderBinaryDataToStorage(
 		ProviderSpecificInstance: pi,
 		H1Checksum:               hash,
 		FullPath:                 fullPath,
+		Size:                     int64(len(binaryData)),
+		MirroredAt:               time.Now().UTC(),
 	}, nil
 }
 
-func (s FSProviderStorageConfiguration) StoreCatalog(psibs []ProviderSpecificInstanceBinary) error {
-	versionMap := make(map[string][]ProviderSpecificInstanceBinary)
-	mirrorIndex := MirrorIndex{
-		Versions: make(map[string]map[string]any),
+// extracts the zip into the unpacked layout; the h1 hash is taken from the extracted files, which is what
+// Terraform checks an unpacked filesystem mirror against
+func (s FSProviderStorageConfiguration) writeUnpacked(binaryData []byte, pi ProviderSpecificInstance) (*ProviderSpecificInstanceBinary, error) {
+	fullPath := filepath.Join(s.downloadRoot, unpackedInstancePath(pi))
+	err := extractProviderZip(binaryData, fullPath)
+	if err != nil {
+		return nil, fmt.Errorf("error extracting %s: %w", pi.GetDownloadedFileName(), err)
+	}
+	hash, err := hashUnpackedDir(fullPath)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, psib := range psibs {
-		if _, ok := versionMap[psib.Version]; !ok {
-			versionMap[psib.Version] = []ProviderSpecificInstanceBinary{}
-		}
-		versionMap[psib.Version] = append(versionMap[psib.Version], psib)
+	return &ProviderSpecificInstanceBinary{
+		ProviderSpecificInstance: pi,
+		H1Checksum:               hash,
+		FullPath:                 fullPath,
+		Size:                     int64(len(binaryData)),
+		MirroredAt:               time.Now().UTC(),
+	}, nil
+}
+
+func hashUnpackedDir(dir string) (string, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", dir)
 	}
+	return dirhash.HashDir(dir, "", dirhash.Hash1)
+}
 
-	for version, binaries := range versionMap {
-		mirrorArchives := MirrorArchives{
-			Archives: make(map[string]MirrorProviderPlatformArch),
+func (s FSProviderStorageConfiguration) ReadProviderBinaryDataFromStorage(psib ProviderSpecificInstanceBinary) ([]byte, error) {
+	if s.layout == fsLayoutUnpacked {
+		return zipProviderDir(psib.FullPath)
+	}
+	return os.ReadFile(psib.FullPath)
+}
+
+func (s FSProviderStorageConfiguration) DeleteProviderBinaryFromStorage(psib ProviderSpecificInstanceBinary) error {
+	if s.layout == fsLayoutUnpacked {
+		err := os.RemoveAll(psib.FullPath)
+		if err != nil {
+			return err
 		}
+		// the version directory goes as well once its last platform is gone, failing is fine if it is not empty
+		_ = os.Remove(filepath.Dir(psib.FullPath))
+		return nil
+	}
+	err := os.Remove(psib.FullPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
 
-		for _, binary := range binaries {
-			osArch := fmt.Sprintf("%s_%s", binary.OS, binary.Arch)
-			mirrorArchives.Archives[osArch] = MirrorProviderPlatformArch{
-				Hashes: []string{binary.H1Checksum},
-				URL:    binary.GetDownloadedFileName(),
-			}
+func (s FSProviderStorageConfiguration) LoadFirstSeen() (map[string]time.Time, error) {
+	firstSeen := make(map[string]time.Time)
+	contents, err := os.ReadFile(filepath.Join(s.downloadRoot, s.provider.GetDownloadBase(), firstSeenFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return firstSeen, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(contents, &firstSeen)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling %s: %w", firstSeenFile, err)
+	}
+	return firstSeen, nil
+}
+
+func (s FSProviderStorageConfiguration) StoreFirstSeen(firstSeen map[string]time.Time) error {
+	firstSeenJson, err := json.MarshalIndent(firstSeen, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling first seen JSON: %w", err)
+	}
+	dirPath := filepath.Join(s.downloadRoot, s.provider.GetDownloadBase())
+	err = os.MkdirAll(dirPath, os.FileMode(0755))
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dirPath, firstSeenFile), firstSeenJson, os.FileMode(0644))
+}
+
+func (s FSProviderStorageConfiguration) StoreCatalog(psibs []ProviderSpecificInstanceBinary) error {
+	mirrorIndex, versionArchives := commonBuildMirrorCatalog(psibs)
+	if s.layout == fsLayoutUnpacked {
+		// the catalog points at the extracted directories, so the JSON files are only for tfspiegel itself
+		for _, psib := range psibs {
+			osArch := fmt.Sprintf("%s_%s", psib.OS, psib.Arch)
+			archive := versionArchives[psib.Version].Archives[osArch]
+			archive.URL = path.Join(psib.Version, osArch)
+			versionArchives[psib.Version].Archives[osArch] = archive
 		}
+	}
 
+	for version, mirrorArchives := range versionArchives {
 		versionJson, err := json.MarshalIndent(mirrorArchives, "", "  ")
 		if err != nil {
 			return fmt.Errorf("error marshalling version JSON: %w", err)
 		}
 
 		versionJsonPath := filepath.Join(s.downloadRoot, s.provider.GetDownloadBase(), fmt.Sprintf("%s.json", version))
-		err = os.WriteFile(versionJsonPath, versionJson, os.FileMode(0644))
+		err = writeFileAtomic(versionJsonPath, versionJson, os.FileMode(0644))
 		if err != nil {
 			return fmt.Errorf("error writing version JSON: %w", err)
 		}
+	}
 
-		mirrorIndex.Versions[version] = make(map[string]any)
+	metadataJson, err := json.MarshalIndent(commonBuildCatalogMetadata(psibs), "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling catalog metadata JSON: %w", err)
+	}
+	metadataJsonPath := filepath.Join(s.downloadRoot, s.provider.GetDownloadBase(), catalogMetadataFile)
+	err = writeFileAtomic(metadataJsonPath, metadataJson, os.FileMode(0644))
+	if err != nil {
+		return fmt.Errorf("error writing catalog metadata JSON: %w", err)
 	}
 
+	// the index goes last, so that it never lists anything the other files do not cover yet
 	mirrorIndexJson, err := json.MarshalIndent(mirrorIndex, "", "  ")
 	if err != nil {
 		return fmt.Errorf("error marshalling mirror index JSON: %w", err)
 	}
 	mirrorIndexJsonPath := filepath.Join(s.downloadRoot, s.provider.GetDownloadBase(), mirrorIndexFile)
-	err = os.WriteFile(mirrorIndexJsonPath, mirrorIndexJson, os.FileMode(0644))
+	err = writeFileAtomic(mirrorIndexJsonPath, mirrorIndexJson, os.FileMode(0644))
 	if err != nil {
 		return fmt.Errorf("error writing index JSON: %w", err)
 	}
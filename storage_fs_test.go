@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"go.uber.org/zap"
 	"golang.org/x/mod/sumdb/dirhash"
@@ -450,6 +451,31 @@ func TestFSWriteProviderBinaryDataToStorage(t *testing.T) {
 func TestFSStoreCatalog(t *testing.T) {
 	provider := testProvider()
 
+	t.Run("index is written last", func(t *testing.T) {
+		root := t.TempDir()
+		providerDir := filepath.Join(root, provider.GetDownloadBase())
+		// a directory where the metadata goes makes writing it fail
+		if err := os.MkdirAll(filepath.Join(providerDir, catalogMetadataFile), 0755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+
+		psibs := []ProviderSpecificInstanceBinary{
+			{
+				ProviderSpecificInstance: ProviderSpecificInstance{
+					Provider: provider, Version: "5.0.0", OS: "linux", Arch: "amd64",
+				},
+				H1Checksum: "h1:abc123",
+			},
+		}
+		s := FSProviderStorageConfiguration{downloadRoot: root, provider: provider, sugar: testSugar()}
+		if err := s.StoreCatalog(psibs); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+		if _, err := os.Stat(filepath.Join(providerDir, mirrorIndexFile)); !os.IsNotExist(err) {
+			t.Errorf("expected no index.json when the metadata could not be written, got %v", err)
+		}
+	})
+
 	t.Run("single version single arch", func(t *testing.T) {
 		root := t.TempDir()
 		providerDir := filepath.Join(root, provider.GetDownloadBase())
@@ -611,3 +637,71 @@ func TestFSReconcileWantedProviderInstances(t *testing.T) {
 		t.Errorf("expected 0 (already valid), got %d", len(got))
 	}
 }
+
+func TestFSCatalogMetadataRoundTrip(t *testing.T) {
+	provider := testProvider()
+	root := t.TempDir()
+	s := FSProviderStorageConfiguration{downloadRoot: root, provider: provider, sugar: testSugar()}
+
+	zipBytes, _ := createTestZip(t, "provider.exe", "binary content")
+	pi := ProviderSpecificInstance{Provider: provider, Version: "5.0.0", OS: "linux", Arch: "amd64"}
+	psib, err := s.WriteProviderBinaryDataToStorage(zipBytes, pi)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if psib.Size != int64(len(zipBytes)) {
+		t.Errorf("size = %d, want %d", psib.Size, len(zipBytes))
+	}
+	if psib.MirroredAt.IsZero() {
+		t.Error("expected mirror timestamp to be set")
+	}
+
+	psib.PublishedAt = time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	err = s.StoreCatalog([]ProviderSpecificInstanceBinary{*psib})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	psibs, err := s.LoadCatalog()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(psibs) != 1 {
+		t.Fatalf("expected 1 psib, got %d", len(psibs))
+	}
+	if psibs[0].Size != psib.Size {
+		t.Errorf("loaded size = %d, want %d", psibs[0].Size, psib.Size)
+	}
+	if !psibs[0].MirroredAt.Equal(psib.MirroredAt) {
+		t.Errorf("loaded mirror time = %s, want %s", psibs[0].MirroredAt, psib.MirroredAt)
+	}
+	if !psibs[0].PublishedAt.Equal(psib.PublishedAt) {
+		t.Errorf("loaded publish time = %s, want %s", psibs[0].PublishedAt, psib.PublishedAt)
+	}
+}
+
+func TestFSFirstSeenRoundTrip(t *testing.T) {
+	s := FSProviderStorageConfiguration{downloadRoot: t.TempDir(), provider: testProvider(), sugar: testSugar()}
+
+	firstSeen, err := s.LoadFirstSeen()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(firstSeen) != 0 {
+		t.Errorf("expected nothing before anything was stored, got %v", firstSeen)
+	}
+
+	firstSeen["5.0.0"] = time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	err = s.StoreFirstSeen(firstSeen)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	loaded, err := s.LoadFirstSeen()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !loaded["5.0.0"].Equal(firstSeen["5.0.0"]) {
+		t.Errorf("loaded %v, want %v", loaded, firstSeen)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// where an instance lives in the unpacked filesystem_mirror layout, HOSTNAME/NAMESPACE/TYPE/VERSION/TARGET
+func unpackedInstancePath(pi ProviderSpecificInstance) string {
+	return filepath.Join(pi.GetDownloadBase(), pi.Version, fmt.Sprintf("%s_%s", pi.OS, pi.Arch))
+}
+
+// extracts a provider zip into dir, replacing anything that was there. The zip is extracted next to dir first
+// and renamed into place, so that dir never holds a partly extracted provider. Entries that would end up outside
+// of dir (zip slip) and symlinks are refused.
+func extractProviderZip(data []byte, dir string) error {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+
+	parent := filepath.Dir(dir)
+	err = os.MkdirAll(parent, 0o755)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(parent, "."+filepath.Base(dir)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(tmp) }()
+
+	for _, file := range reader.File {
+		target, err := safeExtractPath(tmp, file.Name)
+		if err != nil {
+			return err
+		}
+		mode := file.Mode()
+		switch {
+		case mode&fs.ModeSymlink != 0:
+			return fmt.Errorf("zip entry %s is a symlink", file.Name)
+		case mode.IsDir():
+			err = os.MkdirAll(target, 0o755)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = os.MkdirAll(filepath.Dir(target), 0o755)
+		if err != nil {
+			return err
+		}
+		perm := mode.Perm()
+		if perm == 0 {
+			perm = 0o644
+		}
+		err = extractZipFile(file, target, perm)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.RemoveAll(dir)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, dir)
+}
+
+// joins a zip entry name onto dir, refusing names that are absolute or climb out of dir
+func safeExtractPath(dir string, name string) (string, error) {
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "/") || strings.Contains(name, `\`) {
+		return "", fmt.Errorf("zip entry %s has an unsafe path", name)
+	}
+	target := filepath.Join(dir, filepath.FromSlash(name))
+	rel, err := filepath.Rel(dir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("zip entry %s would be extracted outside of %s", name, dir)
+	}
+	return target, nil
+}
+
+func extractZipFile(file *zip.File, target string, perm fs.FileMode) error {
+	in, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// packs an unpacked provider back into a zip, for export and anything else that needs the archive. The h1 hash
+// of the zip is the same as that of the directory, as it only covers file names and contents.
+func zipProviderDir(dir string) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		header.Method = zip.Deflate
+		w, err := writer.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		_, err = io.Copy(w, f)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFSUnpackedLayoutRoundTrip(t *testing.T) {
+	provider := testProvider()
+	root := t.TempDir()
+	s := FSProviderStorageConfiguration{downloadRoot: root, provider: provider, layout: fsLayoutUnpacked, sugar: testSugar()}
+
+	zipBytes, expectedHash := createTestZip(t, "terraform-provider-aws_v5.0.0", "binary content")
+	pi := ProviderSpecificInstance{Provider: provider, Version: "5.0.0", OS: "linux", Arch: "amd64"}
+	psib, err := s.WriteProviderBinaryDataToStorage(zipBytes, pi)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if psib.H1Checksum != expectedHash {
+		t.Errorf("hash = %s, want %s", psib.H1Checksum, expectedHash)
+	}
+	expectedPath := filepath.Join(root, "registry.terraform.io", "hashicorp", "aws", "5.0.0", "linux_amd64")
+	if psib.FullPath != expectedPath {
+		t.Errorf("path = %s, want %s", psib.FullPath, expectedPath)
+	}
+	content, err := os.ReadFile(filepath.Join(expectedPath, "terraform-provider-aws_v5.0.0"))
+	if err != nil || string(content) != "binary content" {
+		t.Fatalf("extracted file = %q, %v", content, err)
+	}
+
+	err = s.StoreCatalog([]ProviderSpecificInstanceBinary{*psib})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	catalog, err := s.LoadCatalog()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(catalog) != 1 || catalog[0].FullPath != expectedPath {
+		t.Fatalf("catalog = %#v, want one entry at %s", catalog, expectedPath)
+	}
+
+	valid, invalid, err := s.VerifyCatalogAgainstStorage(catalog)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(valid) != 1 || len(invalid) != 0 {
+		t.Fatalf("got %d valid and %d invalid, want 1 and 0", len(valid), len(invalid))
+	}
+
+	// the zip rebuilt from the directory must carry the same h1 hash as the original
+	data, err := s.ReadProviderBinaryDataFromStorage(catalog[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hash, err := h1HashOfZip(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hash != expectedHash {
+		t.Errorf("rebuilt zip hash = %s, want %s", hash, expectedHash)
+	}
+
+	err = os.WriteFile(filepath.Join(expectedPath, "terraform-provider-aws_v5.0.0"), []byte("tampered"), 0o644)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, invalid, err = s.VerifyCatalogAgainstStorage(catalog)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(invalid) != 1 {
+		t.Errorf("got %d invalid after tampering, want 1", len(invalid))
+	}
+
+	err = s.DeleteProviderBinaryFromStorage(catalog[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(expectedPath)); !os.IsNotExist(err) {
+		t.Errorf("expected the empty version directory to be removed, got %v", err)
+	}
+}
+
+func TestExtractProviderZipRejectsUnsafeEntries(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry string
+		mode  os.FileMode
+	}{
+		{name: "parent directory", entry: "../escaped"},
+		{name: "nested parent directory", entry: "sub/../../escaped"},
+		{name: "absolute path", entry: "/etc/escaped"},
+		{name: "backslash", entry: `..\escaped`},
+		{name: "symlink", entry: "link", mode: os.ModeSymlink | 0o777},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := zip.NewWriter(&buf)
+			header := &zip.FileHeader{Name: tt.entry, Method: zip.Store}
+			if tt.mode != 0 {
+				header.SetMode(tt.mode)
+			}
+			f, err := w.CreateHeader(header)
+			if err != nil {
+				t.Fatalf("failed to create zip entry: %v", err)
+			}
+			_, _ = f.Write([]byte("/etc/passwd"))
+			if err := w.Close(); err != nil {
+				t.Fatalf("failed to close zip writer: %v", err)
+			}
+
+			root := t.TempDir()
+			dir := filepath.Join(root, "5.0.0", "linux_amd64")
+			err = extractProviderZip(buf.Bytes(), dir)
+			if err == nil {
+				t.Fatal("expected error for unsafe entry")
+			}
+			if _, err := os.Stat(filepath.Join(root, "escaped")); !os.IsNotExist(err) {
+				t.Error("entry was written outside of the target directory")
+			}
+			if _, err := os.Stat(dir); !os.IsNotExist(err) {
+				t.Error("target directory should not exist after a failed extraction")
+			}
+		})
+	}
+}
+
+func TestFSPackedLayoutMatchesNetworkMirror(t *testing.T) {
+	provider := testProvider()
+	root := t.TempDir()
+	s := FSProviderStorageConfiguration{downloadRoot: root, provider: provider, layout: fsLayoutPacked, sugar: testSugar()}
+
+	zipBytes, _ := createTestZip(t, "provider.exe", "binary content")
+	pi := ProviderSpecificInstance{Provider: provider, Version: "5.0.0", OS: "linux", Arch: "amd64"}
+	psib, err := s.WriteProviderBinaryDataToStorage(zipBytes, pi)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedPath := filepath.Join(root, "registry.terraform.io", "hashicorp", "aws", "terraform-provider-aws_5.0.0_linux_amd64.zip")
+	if psib.FullPath != expectedPath {
+		t.Errorf("path = %s, want %s", psib.FullPath, expectedPath)
+	}
+}
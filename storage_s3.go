@@ -2,20 +2,91 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
 	awss3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/xorcare/pointer"
 	"golang.org/x/mod/sumdb/dirhash"
 )
 
+func newS3Client(ctx context.Context, config s3Config) (*awss3.Client, error) {
+	awscfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var s3opts []func(*awss3.Options)
+	if config.Endpoint != "" {
+		const defaultRegion = "us-east-1"
+		awscfg.Region = defaultRegion
+		endpoint := config.Endpoint
+		s3opts = append(s3opts, func(o *awss3.Options) {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		})
+	}
+	return awss3.NewFromConfig(awscfg, s3opts...), nil
+}
+
+func newS3ReachabilityCheck(ctx context.Context, config s3Config) (func(context.Context) error, error) {
+	s3client, err := newS3Client(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		_, err := s3client.HeadBucket(ctx, &awss3.HeadBucketInput{
+			Bucket: &config.Bucket,
+		})
+		return err
+	}, nil
+}
+
+func listS3StoredProviders(ctx context.Context, config s3Config) ([]Provider, error) {
+	s3client, err := newS3Client(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	// keys are built with filepath.Join, which drops slashes around the prefix
+	prefix := strings.Trim(config.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	var providers []Provider
+	var continuationToken *string
+	for {
+		objectListOutput, err := s3client.ListObjectsV2(ctx, &awss3.ListObjectsV2Input{
+			Bucket:            &config.Bucket,
+			ContinuationToken: continuationToken,
+			Prefix:            &prefix,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list objects from S3: %w", err)
+		}
+		for _, object := range objectListOutput.Contents {
+			if provider, ok := providerFromIndexPath(strings.TrimPrefix(aws.ToString(object.Key), prefix)); ok {
+				providers = append(providers, provider)
+			}
+		}
+		if !aws.ToBool(objectListOutput.IsTruncated) {
+			break
+		}
+		continuationToken = objectListOutput.NextContinuationToken
+	}
+	return providers, nil
+}
+
 func (s S3ProviderStorageConfiguration) LoadCatalog() ([]ProviderSpecificInstanceBinary, error) {
 	indexFullPath := filepath.Join(s.prefix, s.provider.String(), mirrorIndexFile)
 	indexObjectOutput, err := s.s3client.GetObject(s.context, &awss3.GetObjectInput{
@@ -26,6 +97,7 @@ func (s S3ProviderStorageConfiguration) LoadCatalog() ([]ProviderSpecificInstanc
 		s.sugar.Errorf("unable to get index file %s from S3: %v", indexFullPath, err)
 		return nil, fmt.Errorf("error loading catalog: %w", err)
 	}
+	defer func() { _ = indexObjectOutput.Body.Close() }()
 	indexContents, err := io.ReadAll(indexObjectOutput.Body)
 	if err != nil {
 		s.sugar.Errorf("unable to read index file %s: %v", indexFullPath, err)
@@ -52,6 +124,7 @@ func (s S3ProviderStorageConfiguration) LoadCatalog() ([]ProviderSpecificInstanc
 		s.sugar.Errorf("unable to get etag map file %s from S3: %v", etagMapFullPath, err)
 		return nil, fmt.Errorf("error loading catalog: %w", err)
 	}
+	defer func() { _ = etagMapObjectOutput.Body.Close() }()
 	etagMapContents, err := io.ReadAll(etagMapObjectOutput.Body)
 	if err != nil {
 		s.sugar.Errorf("unable to read etag map file %s: %v", etagMapFullPath, err)
@@ -79,6 +152,8 @@ func (s S3ProviderStorageConfiguration) LoadCatalog() ([]ProviderSpecificInstanc
 			continue
 		}
 		versionJsonContents, err := io.ReadAll(versionJsonObjectOutput.Body)
+		// closed straight away rather than deferred, as there is one object per version
+		_ = versionJsonObjectOutput.Body.Close()
 		if err != nil {
 			s.sugar.Errorf("unable to read version JSON file %s: %v", versionJsonFullPath, err)
 			continue
@@ -121,6 +196,30 @@ func (s S3ProviderStorageConfiguration) LoadCatalog() ([]ProviderSpecificInstanc
 		}
 	}
 
+	// older mirrors won't have the metadata object, which only means that sizes and timestamps are unknown
+	metadataFullPath := filepath.Join(s.prefix, s.provider.String(), catalogMetadataFile)
+	metadataObjectOutput, err := s.s3client.GetObject(s.context, &awss3.GetObjectInput{
+		Bucket: &s.bucket,
+		Key:    &metadataFullPath,
+	})
+	if err != nil {
+		s.sugar.Debugf("unable to get catalog metadata file %s from S3: %v", metadataFullPath, err)
+		return psibs, nil
+	}
+	defer func() { _ = metadataObjectOutput.Body.Close() }()
+	metadataContents, err := io.ReadAll(metadataObjectOutput.Body)
+	if err != nil {
+		s.sugar.Errorf("unable to read catalog metadata file %s: %v", metadataFullPath, err)
+		return psibs, nil
+	}
+	var metadata CatalogMetadata
+	err = json.Unmarshal(metadataContents, &metadata)
+	if err != nil {
+		s.sugar.Errorf("unable to unmarshal catalog metadata file %s: %v", metadataFullPath, err)
+		return psibs, nil
+	}
+	commonApplyCatalogMetadata(psibs, metadata)
+
 	return psibs, nil
 }
 
@@ -229,41 +328,90 @@ func (s S3ProviderStorageConfiguration) WriteProviderBinaryDataToStorage(
 			ETag:       *putObjectOutput.ETag,
 			H1Checksum: hash,
 		},
-		FullPath: key,
+		FullPath:   key,
+		Size:       int64(len(binaryData)),
+		MirroredAt: time.Now().UTC(),
 	}
 	return psib, nil
 }
 
-func (s S3ProviderStorageConfiguration) StoreCatalog(psibs []ProviderSpecificInstanceBinary) error {
-	versionMap := make(map[string][]ProviderSpecificInstanceBinary)
-	mirrorIndex := MirrorIndex{
-		Versions: make(map[string]map[string]any),
+func (s S3ProviderStorageConfiguration) ReadProviderBinaryDataFromStorage(psib ProviderSpecificInstanceBinary) ([]byte, error) {
+	objectOutput, err := s.s3client.GetObject(s.context, &awss3.GetObjectInput{
+		Bucket: &s.bucket,
+		Key:    &psib.FullPath,
+	})
+	if err != nil {
+		return nil, err
 	}
+	defer func() { _ = objectOutput.Body.Close() }()
+	return io.ReadAll(objectOutput.Body)
+}
 
-	etagMap := make(map[string]S3ObjectChecksum)
+func (s S3ProviderStorageConfiguration) DeleteProviderBinaryFromStorage(psib ProviderSpecificInstanceBinary) error {
+	_, err := s.s3client.DeleteObject(s.context, &awss3.DeleteObjectInput{
+		Bucket: &s.bucket,
+		Key:    &psib.FullPath,
+	})
+	return err
+}
 
-	for _, psib := range psibs {
-		etagMap[psib.GetDownloadedFileName()] = psib.S3ObjectChecksum
+func (s S3ProviderStorageConfiguration) LoadFirstSeen() (map[string]time.Time, error) {
+	firstSeen := make(map[string]time.Time)
+	firstSeenPath := filepath.Join(s.prefix, s.provider.GetDownloadBase(), firstSeenFile)
+	output, err := s.s3client.GetObject(s.context, &awss3.GetObjectInput{
+		Bucket: &s.bucket,
+		Key:    &firstSeenPath,
+	})
+	var noSuchKey *awss3types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return firstSeen, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting %s from S3: %w", firstSeenPath, err)
+	}
+	defer func() { _ = output.Body.Close() }()
+	contents, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(contents, &firstSeen)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling %s: %w", firstSeenPath, err)
+	}
+	return firstSeen, nil
+}
 
-		if _, ok := versionMap[psib.Version]; !ok {
-			versionMap[psib.Version] = []ProviderSpecificInstanceBinary{}
-		}
-		versionMap[psib.Version] = append(versionMap[psib.Version], psib)
+func (s S3ProviderStorageConfiguration) StoreFirstSeen(firstSeen map[string]time.Time) error {
+	firstSeenJson, err := json.MarshalIndent(firstSeen, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling first seen JSON: %w", err)
+	}
+	firstSeenPath := filepath.Join(s.prefix, s.provider.GetDownloadBase(), firstSeenFile)
+	_, err = s.s3client.PutObject(s.context, &awss3.PutObjectInput{
+		Body:        bytes.NewReader(firstSeenJson),
+		Bucket:      &s.bucket,
+		ContentType: pointer.String("application/json"),
+		Key:         &firstSeenPath,
+	})
+	if err != nil {
+		return fmt.Errorf("error writing first seen JSON: %w", err)
 	}
+	return nil
+}
 
-	for version, binaries := range versionMap {
-		mirrorArchives := MirrorArchives{
-			Archives: make(map[string]MirrorProviderPlatformArch),
-		}
+// writes the catalog with index.json last: Terraform and LoadCatalog start from the index, so until it is written
+// they see the previous catalog, whose ETag map and version documents still cover it. s.context is the storage
+// context, which outlives the sync context by the shutdown grace period, so an interrupted sync still gets to
+// write the catalog for what it mirrored.
+func (s S3ProviderStorageConfiguration) StoreCatalog(psibs []ProviderSpecificInstanceBinary) error {
+	mirrorIndex, versionArchives := commonBuildMirrorCatalog(psibs)
 
-		for _, binary := range binaries {
-			osArch := fmt.Sprintf("%s_%s", binary.OS, binary.Arch)
-			mirrorArchives.Archives[osArch] = MirrorProviderPlatformArch{
-				Hashes: []string{binary.H1Checksum},
-				URL:    binary.GetDownloadedFileName(),
-			}
-		}
+	etagMap := make(map[string]S3ObjectChecksum)
+	for _, psib := range psibs {
+		etagMap[psib.GetDownloadedFileName()] = psib.S3ObjectChecksum
+	}
 
+	for version, mirrorArchives := range versionArchives {
 		versionJson, err := json.MarshalIndent(mirrorArchives, "", "  ")
 		if err != nil {
 			return fmt.Errorf("error marshalling version JSON: %w", err)
@@ -282,45 +430,59 @@ func (s S3ProviderStorageConfiguration) StoreCatalog(psibs []ProviderSpecificIns
 		if err != nil {
 			return fmt.Errorf("error writing version JSON: %w", err)
 		}
-
-		mirrorIndex.Versions[version] = make(map[string]any)
 	}
 
-	mirrorIndexJson, err := json.MarshalIndent(mirrorIndex, "", "  ")
+	// now write out our special etag map
+	etagMapJson, err := json.MarshalIndent(etagMap, "", "  ")
 	if err != nil {
-		return fmt.Errorf("error marshalling mirror index JSON: %w", err)
+		return fmt.Errorf("error marshalling etag map JSON: %w", err)
 	}
-	mirrorIndexJsonPath := filepath.Join(s.prefix, s.provider.GetDownloadBase(), mirrorIndexFile)
+	etagMapJsonPath := filepath.Join(s.prefix, s.provider.GetDownloadBase(), s3EtagMapFile)
 
-	mirrorIndexReader := bytes.NewReader(mirrorIndexJson)
+	etagReader := bytes.NewReader(etagMapJson)
 	_, err = s.s3client.PutObject(s.context, &awss3.PutObjectInput{
-		Body:        mirrorIndexReader,
+		Body:        etagReader,
 		Bucket:      &s.bucket,
 		ContentType: pointer.String("application/json"),
-		Key:         &mirrorIndexJsonPath,
+		Key:         &etagMapJsonPath,
 	})
-
 	if err != nil {
-		return fmt.Errorf("error writing index JSON: %w", err)
+		return fmt.Errorf("error writing etag map JSON: %w", err)
 	}
 
-	// now write out our special etag map
-	etagMapJson, err := json.MarshalIndent(etagMap, "", "  ")
+	metadataJson, err := json.MarshalIndent(commonBuildCatalogMetadata(psibs), "", "  ")
 	if err != nil {
-		return fmt.Errorf("error marshalling etag map JSON: %w", err)
+		return fmt.Errorf("error marshalling catalog metadata JSON: %w", err)
 	}
-	etagMapJsonPath := filepath.Join(s.prefix, s.provider.GetDownloadBase(), s3EtagMapFile)
+	metadataJsonPath := filepath.Join(s.prefix, s.provider.GetDownloadBase(), catalogMetadataFile)
 
-	etagReader := bytes.NewReader(etagMapJson)
+	metadataReader := bytes.NewReader(metadataJson)
 	_, err = s.s3client.PutObject(s.context, &awss3.PutObjectInput{
-		Body:        etagReader,
+		Body:        metadataReader,
 		Bucket:      &s.bucket,
 		ContentType: pointer.String("application/json"),
-		Key:         &etagMapJsonPath,
+		Key:         &metadataJsonPath,
 	})
 	if err != nil {
-		return fmt.Errorf("error writing etag map JSON: %w", err)
+		return fmt.Errorf("error writing catalog metadata JSON: %w", err)
 	}
 
+	mirrorIndexJson, err := json.MarshalIndent(mirrorIndex, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling mirror index JSON: %w", err)
+	}
+	mirrorIndexJsonPath := filepath.Join(s.prefix, s.provider.GetDownloadBase(), mirrorIndexFile)
+
+	mirrorIndexReader := bytes.NewReader(mirrorIndexJson)
+	_, err = s.s3client.PutObject(s.context, &awss3.PutObjectInput{
+		Body:        mirrorIndexReader,
+		Bucket:      &s.bucket,
+		ContentType: pointer.String("application/json"),
+		Key:         &mirrorIndexJsonPath,
+	})
+
+	if err != nil {
+		return fmt.Errorf("error writing index JSON: %w", err)
+	}
 	return nil
 }
@@ -1,5 +1,7 @@
 package main
 
+import "time"
+
 type RemoteProviderMetadata struct {
 	Provider
 	ID       string                `json:"id"`
@@ -26,6 +28,17 @@ type ProviderSpecificInstanceBinary struct {
 	H1Checksum       string
 	S3ObjectChecksum S3ObjectChecksum // only relevant for S3 - probably a better way to organize this but this is fast
 	FullPath         string
+	Size             int64
+	MirroredAt       time.Time
+	PublishedAt      time.Time
+}
+
+// options that change how a single sync pass behaves
+type SyncOptions struct {
+	// trust the catalog instead of verifying it against storage, so that only instances missing from it get downloaded
+	NewVersionsOnly bool
+	// where to write the JSON run report at the end of the pass, "-" for stdout and empty for no report
+	ReportPath string
 }
 
 type ProviderStorageType int
@@ -46,5 +59,10 @@ type ProviderStorer interface {
 	VerifyCatalogAgainstStorage(catalog []ProviderSpecificInstanceBinary) (validLocalBinaries []ProviderSpecificInstanceBinary, invalidLocalBinaries []ProviderSpecificInstanceBinary, err error)
 	ReconcileWantedProviderInstances(validPSIBs []ProviderSpecificInstanceBinary, invalidPSIBs []ProviderSpecificInstanceBinary, wantedProviderInstances []ProviderSpecificInstance) []ProviderSpecificInstance
 	WriteProviderBinaryDataToStorage(binaryData []byte, pi ProviderSpecificInstance) (psib *ProviderSpecificInstanceBinary, err error)
+	ReadProviderBinaryDataFromStorage(psib ProviderSpecificInstanceBinary) ([]byte, error)
+	DeleteProviderBinaryFromStorage(psib ProviderSpecificInstanceBinary) error
 	StoreCatalog([]ProviderSpecificInstanceBinary) error
+	// when each version was first seen upstream, by version, for holding back versions younger than min_age
+	LoadFirstSeen() (map[string]time.Time, error)
+	StoreFirstSeen(firstSeen map[string]time.Time) error
 }
@@ -1,22 +1,88 @@
 package main
 
+import "time"
+
 // type used for the config
 type ProviderMirrorConfiguration struct {
 	Reference    string                 `json:"reference" yaml:"reference"`
 	VersionRange string                 `json:"version_range" yaml:"version_range"`
 	SkipVersions []string               `json:"skip_versions" yaml:"skip_versions"`
 	OSArchs      []HCTFProviderPlatform `json:"os_archs" yaml:"os_archs"`
+	// name of an entry in upstreams to mirror from instead of the provider's registry
+	Upstream string `json:"upstream,omitempty" yaml:"upstream,omitempty"`
+	// narrows the versions in the range down further
+	Keep versionPolicyConfig `json:"keep,omitempty" yaml:"keep,omitempty"`
+	// mirror pre-releases that the range matches, not only the ones it names exactly
+	IncludePrereleases bool `json:"include_prereleases,omitempty" yaml:"include_prereleases,omitempty"`
+	// versions are only mirrored once they were first seen upstream at least this long ago
+	MinAge time.Duration `json:"min_age,omitempty" yaml:"min_age,omitempty"`
+	Retry  retryConfig   `json:"retry,omitempty" yaml:"retry,omitempty"`
+	// how much of what is mirrored and downloaded gets checked
+	Verification verificationConfig `json:"verification,omitempty" yaml:"verification,omitempty"`
+
+	// where the stanza was declared, for error messages
+	source string
+	// the keys the stanza sets, so that defaults only fill in the others
+	set map[string]bool
+	// what was wrong with the stanza when it was decoded
+	decodeErrors []string
+	// other stanzas for the same provider, which are mirrored together with this one
+	merged []ProviderMirrorConfiguration
 }
 
 type configRaw struct {
-	Providers   []ProviderMirrorConfiguration `json:"providers" yaml:"providers"`
-	StorageType string                        `json:"storage_type" yaml:"storage_type"`
-	FSConfig    fsConfig                      `json:"fs_config,omitempty" yaml:"fs_config,omitempty"`
-	S3Config    s3Config                      `json:"s3_config,omitempty" yaml:"s3_config,omitempty"`
+	Providers []ProviderMirrorConfiguration `json:"providers" yaml:"providers"`
+	// more files of providers, relative to this file, which can be directories and globs
+	Include     []string `json:"include,omitempty" yaml:"include,omitempty"`
+	StorageType string   `json:"storage_type" yaml:"storage_type"`
+	FSConfig    fsConfig `json:"fs_config,omitempty" yaml:"fs_config,omitempty"`
+	S3Config    s3Config `json:"s3_config,omitempty" yaml:"s3_config,omitempty"`
+
+	// registry that provider references without a hostname belong to, e.g. registry.opentofu.org
+	DefaultProviderHostname string `json:"default_provider_hostname,omitempty" yaml:"default_provider_hostname,omitempty"`
+
+	Upstreams map[string]upstreamConfig `json:"upstreams,omitempty" yaml:"upstreams,omitempty"`
+
+	// settings for provider stanzas that do not set them
+	Defaults providerDefaults `json:"defaults,omitempty" yaml:"defaults,omitempty"`
+	// makes a provider without os_archs, after defaults, an error instead of mirroring the current platform
+	Strict bool `json:"strict,omitempty" yaml:"strict,omitempty"`
+
+	// named lists of platforms that providers can use in os_archs
+	PlatformSets map[string][]HCTFProviderPlatform `json:"platform_sets,omitempty" yaml:"platform_sets,omitempty"`
+
+	// API tokens for private registries, by hostname
+	Credentials map[string]registryCredentialsConfig `json:"credentials,omitempty" yaml:"credentials,omitempty"`
+
+	Notifications notificationsConfig `json:"notifications,omitempty" yaml:"notifications,omitempty"`
+
+	RegistryCache registryCacheConfig `json:"registry_cache,omitempty" yaml:"registry_cache,omitempty"`
+}
+
+// how responses from registries and upstream mirrors are cached between syncs
+type registryCacheConfig struct {
+	// directory to keep the responses in so that they survive restarts, only in memory if empty
+	Dir string `json:"dir,omitempty" yaml:"dir,omitempty"`
+	// how long download info is reused without asking the registry, defaults to defaultDownloadInfoTTL; negative turns this off
+	DownloadInfoTTL time.Duration `json:"download_info_ttl,omitempty" yaml:"download_info_ttl,omitempty"`
+}
+
+// a source other than a provider registry that providers can be mirrored from
+type upstreamConfig struct {
+	// only network_mirror for now
+	Type string `json:"type" yaml:"type"`
+	// base URL of the mirror, the same as the url of a network_mirror block in the Terraform CLI configuration
+	URL string `json:"url" yaml:"url"`
+}
+
+type registryCredentialsConfig struct {
+	Token string `json:"token" yaml:"token"`
 }
 
 type fsConfig struct {
 	DownloadRoot string `json:"download_root" yaml:"download_root"`
+	// network_mirror (the default), packed or unpacked
+	Layout string `json:"layout,omitempty" yaml:"layout,omitempty"`
 }
 
 type s3Config struct {
@@ -25,7 +91,41 @@ type s3Config struct {
 	Prefix   string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
 }
 
+// webhooks that are told about failed syncs, newly mirrored versions and integrity problems
+type notificationsConfig struct {
+	Webhooks []webhookConfig `json:"webhooks,omitempty" yaml:"webhooks,omitempty"`
+	// identical notifications are not sent again within this interval, defaults to defaultNotificationRepeatInterval
+	RepeatInterval time.Duration `json:"repeat_interval,omitempty" yaml:"repeat_interval,omitempty"`
+}
+
+type webhookConfig struct {
+	URL string `json:"url" yaml:"url"`
+	// json (the default) or slack
+	Format  string            `json:"format,omitempty" yaml:"format,omitempty"`
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	// the events to send to this webhook, all of them if empty
+	Events []string `json:"events,omitempty" yaml:"events,omitempty"`
+}
+
 type Configuration struct {
-	Providers           []ProviderMirrorConfiguration
-	DownloadDestination DownloadDestination
+	Providers               []ProviderMirrorConfiguration
+	DownloadDestination     DownloadDestination
+	DefaultProviderHostname string
+	Upstreams               map[string]upstreamConfig
+	Credentials             map[string]registryCredentialsConfig
+	Notifications           notificationsConfig
+	RegistryCache           registryCacheConfig
+	// providers must list their platforms, see configRaw
+	Strict bool
+	// values that came from the environment or from files, which String leaves out
+	secrets []string
+}
+
+// resolves a provider reference from the config or the command line, taking default_provider_hostname into account
+func (c Configuration) NewProvider(reference string) (Provider, error) {
+	hostname := c.DefaultProviderHostname
+	if hostname == "" {
+		hostname = defaultProviderHostname
+	}
+	return newProviderWithDefaultHostname(reference, hostname)
 }
@@ -1,5 +1,7 @@
 package main
 
+import "time"
+
 // types used in the registry response that tells you where to download a provider
 type HCTFSigningKey struct {
 	KeyID          string `json:"key_id"`
@@ -27,8 +29,16 @@ type HCTFProviderPlatform struct {
 	Arch string `json:"arch"`
 }
 
+// the registry's description of a single provider version, which is not part of the provider registry
+// protocol; registry.terraform.io has it, other registries may not
+type HCTFProviderVersionDetails struct {
+	PublishedAt time.Time `json:"published_at"`
+}
+
 type HCTFProviderVersion struct {
 	Version   string                 `json:"version"`
 	Protocols []string               `json:"protocols"`
 	Platforms []HCTFProviderPlatform `json:"platforms"`
+	// not part of the versions list, filled in from the registry when a keep policy needs it
+	PublishedAt time.Time `json:"-"`
 }
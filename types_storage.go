@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"time"
 
 	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
 	"go.uber.org/zap"
@@ -9,10 +10,15 @@ import (
 
 type ProviderDownloader struct {
 	Storage ProviderStorer
+	// where the providers come from, their registry if nil
+	Source       ProviderSource
+	Retry        retryConfig
+	Verification verificationConfig
 }
 
 type FSProviderStorageConfiguration struct {
 	downloadRoot            string
+	layout                  string
 	provider                Provider
 	sugar                   *zap.SugaredLogger
 	wantedProviderInstances []ProviderSpecificInstance
@@ -33,3 +39,16 @@ type S3ObjectChecksum struct {
 	ETag       string
 	H1Checksum string
 }
+
+// information about mirrored binaries that has no place in the network mirror protocol documents,
+// stored next to them so that it survives between runs
+type CatalogMetadata struct {
+	Binaries map[string]BinaryMetadata `json:"binaries"`
+}
+
+type BinaryMetadata struct {
+	Size       int64     `json:"size"`
+	MirroredAt time.Time `json:"mirrored_at"`
+	// when the registry published the version, if it is known
+	PublishedAt time.Time `json:"published_at,omitzero"`
+}
@@ -1,5 +1,13 @@
 package main
 
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
 func StringInSlice(s string, slice []string) bool {
 	for _, x := range slice {
 		if x == s {
@@ -8,3 +16,62 @@ func StringInSlice(s string, slice []string) bool {
 	}
 	return false
 }
+
+// a flag that can be given multiple times, collecting every value
+type stringSliceFlag []string
+
+func (s *stringSliceFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSliceFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// sleeps for the given duration, returning early if the context is cancelled
+func sleepWithContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// returns a context that stays alive for a grace period after ctx is cancelled, for work such as uploads
+// and catalog writes that should be allowed to finish rather than be cut off halfway during a shutdown
+func withGracePeriod(ctx context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	graceCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		time.AfterFunc(grace, cancel)
+	})
+	return graceCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// writes a file by way of a temporary file in the same directory, so that readers never see it half-written
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(tmp.Name(), perm)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
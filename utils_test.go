@@ -1,6 +1,12 @@
 package main
 
-import "testing"
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
 
 func TestStringInSlice(t *testing.T) {
 	tests := []struct {
@@ -25,3 +31,57 @@ func TestStringInSlice(t *testing.T) {
 		})
 	}
 }
+
+func TestSleepWithContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	sleepWithContext(ctx, time.Hour)
+	if time.Since(start) > time.Second {
+		t.Error("sleep did not return early on cancelled context")
+	}
+}
+
+func TestWithGracePeriod(t *testing.T) {
+	parent, cancelParent := context.WithCancel(context.Background())
+	graceCtx, cancel := withGracePeriod(parent, 50*time.Millisecond)
+	defer cancel()
+
+	cancelParent()
+	if graceCtx.Err() != nil {
+		t.Fatal("grace context was cancelled together with its parent")
+	}
+
+	select {
+	case <-graceCtx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("grace context was not cancelled after the grace period")
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "index.json")
+
+	err := writeFileAtomic(path, []byte("first"), 0644)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = writeFileAtomic(path, []byte("second"), 0644)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got) != "second" {
+		t.Errorf("got %q, want %q", got, "second")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected only the written file in the directory, got %d entries", len(entries))
+	}
+}
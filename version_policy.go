@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	semver "github.com/blang/semver/v4"
+)
+
+// which of the versions in a provider's range to keep. A version is kept if any of the set policies selects it;
+// with none set every version in the range is kept.
+type versionPolicyConfig struct {
+	// the newest N versions
+	Latest int `json:"latest,omitempty" yaml:"latest,omitempty"`
+	// the newest N patch releases of every minor version
+	LatestPatchesPerMinor int `json:"latest_patches_per_minor,omitempty" yaml:"latest_patches_per_minor,omitempty"`
+	// the newest version of every major version
+	LatestPerMajor bool `json:"latest_per_major,omitempty" yaml:"latest_per_major,omitempty"`
+	// versions published in the last N days, versions whose publish date is not known are kept
+	ReleasedWithinDays int `json:"released_within_days,omitempty" yaml:"released_within_days,omitempty"`
+}
+
+func (c versionPolicyConfig) isSet() bool {
+	return c.Latest > 0 || c.LatestPatchesPerMinor > 0 || c.LatestPerMajor || c.ReleasedWithinDays > 0
+}
+
+func (c versionPolicyConfig) validate() error {
+	if c.Latest < 0 || c.LatestPatchesPerMinor < 0 || c.ReleasedWithinDays < 0 {
+		return fmt.Errorf("keep policies cannot be negative")
+	}
+	return nil
+}
+
+// a version that passed the range, with what the policies need to know about it
+type candidateVersion struct {
+	version     semver.Version
+	publishedAt time.Time
+}
+
+// returns the versions that the policies keep out of candidates, as strings in the form semver prints them
+func (c versionPolicyConfig) selectVersions(candidates []candidateVersion, now time.Time) map[string]bool {
+	selected := make(map[string]bool)
+	if !c.isSet() {
+		for _, candidate := range candidates {
+			selected[candidate.version.String()] = true
+		}
+		return selected
+	}
+
+	newestFirst := make([]candidateVersion, len(candidates))
+	copy(newestFirst, candidates)
+	sort.Slice(newestFirst, func(i, j int) bool {
+		return newestFirst[i].version.GT(newestFirst[j].version)
+	})
+
+	perMinor := make(map[[2]uint64]int)
+	perMajor := make(map[uint64]bool)
+	cutoff := now.AddDate(0, 0, -c.ReleasedWithinDays)
+	for i, candidate := range newestFirst {
+		v := candidate.version
+		minor := [2]uint64{v.Major, v.Minor}
+		keep := false
+		if i < c.Latest {
+			keep = true
+		}
+		if perMinor[minor] < c.LatestPatchesPerMinor {
+			keep = true
+		}
+		perMinor[minor]++
+		if c.LatestPerMajor && !perMajor[v.Major] {
+			keep = true
+		}
+		perMajor[v.Major] = true
+		if c.ReleasedWithinDays > 0 && (candidate.publishedAt.IsZero() || candidate.publishedAt.After(cutoff)) {
+			keep = true
+		}
+		if keep {
+			selected[v.String()] = true
+		}
+	}
+	return selected
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	semver "github.com/blang/semver/v4"
+)
+
+func TestVersionPolicySelectVersions(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	candidate := func(version string, daysAgo int) candidateVersion {
+		c := candidateVersion{version: semver.MustParse(version)}
+		if daysAgo >= 0 {
+			c.publishedAt = now.AddDate(0, 0, -daysAgo)
+		}
+		return c
+	}
+	candidates := []candidateVersion{
+		candidate("4.66.0", 400),
+		candidate("4.67.0", 300),
+		candidate("4.67.1", 20),
+		candidate("5.0.0", 200),
+		candidate("5.0.1", 190),
+		candidate("5.0.2", 180),
+		candidate("5.1.0", 10),
+		candidate("5.1.1", -1),
+	}
+
+	tests := []struct {
+		name   string
+		policy versionPolicyConfig
+		want   []string
+	}{
+		{
+			"no policy keeps everything",
+			versionPolicyConfig{},
+			[]string{"4.66.0", "4.67.0", "4.67.1", "5.0.0", "5.0.1", "5.0.2", "5.1.0", "5.1.1"},
+		},
+		{
+			"latest n",
+			versionPolicyConfig{Latest: 3},
+			[]string{"5.0.2", "5.1.0", "5.1.1"},
+		},
+		{
+			"latest patches per minor",
+			versionPolicyConfig{LatestPatchesPerMinor: 2},
+			[]string{"4.66.0", "4.67.0", "4.67.1", "5.0.1", "5.0.2", "5.1.0", "5.1.1"},
+		},
+		{
+			"latest per major",
+			versionPolicyConfig{LatestPerMajor: true},
+			[]string{"4.67.1", "5.1.1"},
+		},
+		{
+			"released within days keeps backports and versions without a date",
+			versionPolicyConfig{ReleasedWithinDays: 30},
+			[]string{"4.67.1", "5.1.0", "5.1.1"},
+		},
+		{
+			"policies are a union",
+			versionPolicyConfig{Latest: 1, LatestPerMajor: true, ReleasedWithinDays: 15},
+			[]string{"4.67.1", "5.1.0", "5.1.1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected := tt.policy.selectVersions(candidates, now)
+			var got []string
+			for version := range selected {
+				got = append(got, version)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersionPolicyValidate(t *testing.T) {
+	if err := (versionPolicyConfig{Latest: 2, ReleasedWithinDays: 90}).validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := (versionPolicyConfig{Latest: -1}).validate(); err == nil {
+		t.Error("expected error for a negative policy")
+	}
+}